@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// importFiles lists the files rotated by logrotate, lumberjack or this
+// package next to a file, records them in the manifest and optionally
+// renames them into the naming scheme of this package.
+func importFiles(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	rename := fs.Bool("rename", false, "rename the files into the naming scheme of rotwriter")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rotwriter import [flags] filename")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing file name")
+	}
+
+	// The files renamed before an error are listed as well.
+	files, err := rotwriter.Import(fs.Arg(0), *rename)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSCHEME\tFILE\tNEW FILE")
+	for _, f := range files {
+		newPath := "-"
+		if f.NewPath != f.Path {
+			newPath = f.NewPath
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Time.Format(time.RFC3339), f.Scheme, f.Path, newPath)
+	}
+	if ferr := tw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+// Command rotwriter provides tools around the files of rotate writers.
+//
+// Usage:
+//
+//	rotwriter <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	import    record files rotated by logrotate or lumberjack and optionally rename them
+//	query     select records of JSON lines files by field predicates
+//	serve     accept log lines via HTTP or syslog and write them into rotating files
+//	simulate  replay a write trace against a rotation and retention policy
+//	stat      list rotated files with their top message patterns
+//
+// Run "rotwriter <command> -h" for the flags of a command.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// A command is a subcommand of rotwriter.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"import", "record files rotated by logrotate or lumberjack and optionally rename them", importFiles},
+	{"query", "select records of JSON lines files by field predicates", query},
+	{"serve", "accept log lines via HTTP or syslog and write them into rotating files", serve},
+	{"simulate", "replay a write trace against a rotation and retention policy", simulate},
+	{"stat", "list rotated files with their top message patterns", stat},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "rotwriter %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "rotwriter: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: rotwriter <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", cmd.name, cmd.usage)
+	}
+}
+
+// tierFlags is a repeatable flag describing a tier as
+// DIR[,AGE[,RETENTION[,compress]]] with durations as accepted by
+// time.ParseDuration.
+type tierFlags []rotwriter.Tier
+
+func (t *tierFlags) String() string {
+	var dirs []string
+	for _, tier := range *t {
+		dirs = append(dirs, tier.Dir)
+	}
+	return strings.Join(dirs, " ")
+}
+
+func (t *tierFlags) Set(value string) error {
+	fields := strings.Split(value, ",")
+	if len(fields) > 4 || fields[0] == "" {
+		return fmt.Errorf("invalid tier %q", value)
+	}
+
+	tier := rotwriter.Tier{Dir: fields[0]}
+	for i, d := range []*time.Duration{&tier.Age, &tier.Retention} {
+		if len(fields) > i+1 && fields[i+1] != "" {
+			var err error
+			if *d, err = time.ParseDuration(fields[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+	if len(fields) == 4 {
+		if fields[3] != "compress" {
+			return fmt.Errorf("invalid tier option %q", fields[3])
+		}
+		tier.Compress = true
+	}
+	*t = append(*t, tier)
+	return nil
+}
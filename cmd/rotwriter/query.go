@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// query prints the records of the files of a rotate writer holding JSON
+// lines that match the predicates given by flags.
+func query(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	var q rotwriter.Query
+	fs.Var((*tierFlags)(&q.Tiers), "tier", "tier as DIR[,AGE[,RETENTION[,compress]]] (repeatable)")
+	fs.Var(predicateFlag{&q, "eq"}, "eq", "select records with FIELD=VALUE (repeatable)")
+	fs.Var(predicateFlag{&q, "range"}, "range", "select records with FIELD=MIN..MAX, either bound may be empty (repeatable)")
+	fs.Var(predicateFlag{&q, "match"}, "match", "select records with FIELD=REGEXP (repeatable)")
+	fs.Var(predicateFlag{&q, "exists"}, "exists", "select records having FIELD (repeatable)")
+	from := fs.String("from", "", "start of the time range (RFC 3339)")
+	to := fs.String("to", "", "end of the time range (RFC 3339)")
+	fields := fs.String("fields", "", "comma separated fields to output (default: all)")
+	format := fs.String("format", "json", "output format, json or table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rotwriter query [flags] filename")
+		fmt.Fprintln(fs.Output(), "\nValues of -eq and bounds of -range are parsed as JSON if possible and taken as strings otherwise.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing file name")
+	}
+
+	var err error
+	if *from != "" {
+		if q.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if q.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return err
+		}
+	}
+	if *fields != "" {
+		q.Fields = strings.Split(*fields, ",")
+	}
+
+	switch *format {
+	case "json":
+		return q.WriteJSON(os.Stdout, fs.Arg(0))
+	case "table":
+		return q.WriteTable(os.Stdout, fs.Arg(0))
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// predicateFlag is a repeatable flag adding a predicate of a kind to a query.
+type predicateFlag struct {
+	q    *rotwriter.Query
+	kind string
+}
+
+func (f predicateFlag) String() string {
+	return ""
+}
+
+func (f predicateFlag) Set(value string) error {
+	if f.kind == "exists" {
+		f.q.Predicates = append(f.q.Predicates, rotwriter.Exists(value))
+		return nil
+	}
+
+	field, arg, ok := strings.Cut(value, "=")
+	if !ok || field == "" {
+		return fmt.Errorf("want FIELD=%s", strings.ToUpper(f.kind))
+	}
+
+	var p rotwriter.Predicate
+	switch f.kind {
+	case "eq":
+		p = rotwriter.Equal(field, jsonValue(arg))
+	case "range":
+		min, max, ok := strings.Cut(arg, "..")
+		if !ok {
+			return errors.New("want FIELD=MIN..MAX")
+		}
+		var lo, hi interface{}
+		if min != "" {
+			lo = jsonValue(min)
+		}
+		if max != "" {
+			hi = jsonValue(max)
+		}
+		p = rotwriter.Range(field, lo, hi)
+	case "match":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return err
+		}
+		p = rotwriter.Match(field, re)
+	}
+	f.q.Predicates = append(f.q.Predicates, p)
+	return nil
+}
+
+// jsonValue parses s as JSON or returns it as a string if it is no valid
+// JSON.
+func jsonValue(s string) interface{} {
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	return v
+}
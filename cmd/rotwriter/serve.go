@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// serve runs an HTTP server and optionally syslog listeners writing the
+// received log lines into one rotating file per key until it receives SIGINT
+// or SIGTERM. If the environment variable ROTWRITER_TOKEN is set, HTTP
+// requests must carry it as a bearer token.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory of the log files")
+	ext := fs.String("ext", ".log", "extension of the log files")
+	maxSize := fs.Int64("max-size", rotwriter.DefaultSize, "maximum size of a log file in bytes")
+	addr := fs.String("http", ":8080", "listen address of the HTTP server (empty to disable)")
+	keyHeader := fs.String("key-header", "", "request header holding the key (default: the URL path)")
+	maxBytes := fs.Int64("max-bytes", rotwriter.DefaultMaxBytes, "maximum size of a request body in bytes")
+	headerTimeout := fs.Duration("read-header-timeout", 10*time.Second, "time to read the headers of an HTTP request")
+	readTimeout := fs.Duration("read-timeout", time.Minute, "time to read a whole HTTP request")
+	idleTimeout := fs.Duration("idle-timeout", 2*time.Minute, "time an idle HTTP connection is kept open")
+	udpAddr := fs.String("syslog-udp", "", "listen address for syslog over UDP")
+	tcpAddr := fs.String("syslog-tcp", "", "listen address for syslog over TCP")
+	hosts := fs.String("syslog-hosts", "", "comma separated host names accepted from syslog messages (default: all)")
+	maxWriters := fs.Int("max-writers", 1000, "maximum number of open log files (0 for no limit)")
+	fs.Parse(args)
+
+	if *addr == "" && *udpAddr == "" && *tcpAddr == "" {
+		return errors.New("no listen address")
+	}
+
+	// The token is taken from the environment to keep it out of the
+	// process list.
+	token := os.Getenv("ROTWRITER_TOKEN")
+
+	m := rotwriter.NewManager(*dir, *ext, *maxSize)
+	m.SetMaxWriters(*maxWriters)
+	defer m.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 3)
+
+	syslog := &rotwriter.SyslogServer{Open: m.Writer}
+	if *hosts != "" {
+		allowed := make(map[string]bool)
+		for _, host := range strings.Split(*hosts, ",") {
+			allowed[strings.ToLower(strings.TrimSpace(host))] = true
+		}
+		syslog.AllowHost = func(host string) bool { return allowed[host] }
+	}
+	if *udpAddr != "" {
+		conn, err := net.ListenPacket("udp", *udpAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		go func() { errc <- syslog.ServeUDP(conn) }()
+	}
+	if *tcpAddr != "" {
+		l, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		go func() { errc <- syslog.ServeTCP(l) }()
+	}
+
+	var srv *http.Server
+	if *addr != "" {
+		h := &rotwriter.Handler{
+			Open:      m.Writer,
+			KeyHeader: *keyHeader,
+			MaxBytes:  *maxBytes,
+		}
+		if token != "" {
+			h.Authorize = func(r *http.Request) error {
+				if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+					return errors.New("invalid token")
+				}
+				return nil
+			}
+		}
+
+		srv = &http.Server{
+			Addr:              *addr,
+			Handler:           h,
+			ReadHeaderTimeout: *headerTimeout,
+			ReadTimeout:       *readTimeout,
+			IdleTimeout:       *idleTimeout,
+		}
+		go func() { errc <- srv.ListenAndServe() }()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+	if srv != nil {
+		// Wait for running requests before the writers are closed.
+		srv.Shutdown(context.Background())
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
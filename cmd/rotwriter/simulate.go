@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// simulate replays a write trace against a rotation and retention policy
+// and prints the resulting files, deletions and disk usage.
+func simulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	filename := fs.String("filename", "app.log", "name of the simulated file")
+	var policy rotwriter.Policy
+	fs.Int64Var(&policy.MaxSize, "max-size", rotwriter.DefaultSize, "maximum size of a file in bytes")
+	fs.Var((*tierFlags)(&policy.Tiers), "tier", "tier as DIR[,AGE[,RETENTION[,compress]]] (repeatable)")
+	fs.DurationVar(&policy.TierInterval, "tier-interval", 0, "interval of applying the tiers (default: after each rotation)")
+	fs.Float64Var(&policy.CompressRatio, "compress-ratio", 0, "size of compressed files relative to their original size")
+	showUsage := fs.Bool("usage", false, "print the disk usage after every change")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rotwriter simulate [flags] trace")
+		fmt.Fprintln(fs.Output(), "\nThe trace holds one write per line: an RFC 3339 time and a size in bytes.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing trace")
+	}
+
+	trace, err := readTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	sim := rotwriter.Simulate(*filename, trace, policy)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROTATED\tSIZE\tTIER\tDELETED\tFILE")
+	for _, seg := range sim.Segments {
+		deleted := "-"
+		if !seg.Deleted.IsZero() {
+			deleted = seg.Deleted.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", seg.Time.Format(time.RFC3339), seg.Size, seg.Tier, deleted, seg.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	peak := make([]int64, len(policy.Tiers)+1)
+	fmt.Println()
+	if *showUsage {
+		fmt.Fprintln(tw, "TIME\tBYTES PER TIER")
+	}
+	for _, u := range sim.Usage {
+		for i, n := range u.Bytes {
+			if n > peak[i] {
+				peak[i] = n
+			}
+		}
+		if *showUsage {
+			fmt.Fprintf(tw, "%s\t%s\n", u.Time.Format(time.RFC3339), joinInts(u.Bytes))
+		}
+	}
+	if *showUsage {
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "files\t%d\n", len(sim.Segments))
+	fmt.Fprintf(tw, "deletions\t%d\n", len(sim.Deletions))
+	fmt.Fprintf(tw, "peak bytes per tier\t%s\n", joinInts(peak))
+	if n := len(sim.Usage); n > 0 {
+		fmt.Fprintf(tw, "final bytes per tier\t%s\n", joinInts(sim.Usage[n-1].Bytes))
+	}
+	return tw.Flush()
+}
+
+// readTrace reads a write trace holding a time and a size per line. Empty
+// lines and lines starting with # are skipped.
+func readTrace(name string) ([]rotwriter.TraceWrite, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var trace []rotwriter.TraceWrite
+	s := bufio.NewScanner(file)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' })
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a time and a size", name, line)
+		}
+		t, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		trace = append(trace, rotwriter.TraceWrite{Time: t, Size: size})
+	}
+	return trace, s.Err()
+}
+
+func joinInts(values []int64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatInt(v, 10)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perron2/rotwriter"
+)
+
+// stat lists the rotated files of a rotate writer together with the top
+// patterns recorded for them in the manifest.
+func stat(args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	var tiers tierFlags
+	fs.Var(&tiers, "tier", "tier as DIR[,AGE[,RETENTION[,compress]]] (repeatable)")
+	top := fs.Int("top", 3, "number of patterns shown per file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rotwriter stat [flags] filename")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing file name")
+	}
+	filename := fs.Arg(0)
+
+	segments, err := rotwriter.Segments(filename, tiers)
+	if err != nil {
+		return err
+	}
+	entries, err := rotwriter.ReadManifest(filename)
+	if err != nil {
+		return err
+	}
+	patterns := make(map[string][]rotwriter.Pattern)
+	for _, entry := range entries {
+		if entry.Patterns != nil {
+			patterns[entry.Name] = entry.Patterns
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSIZE\tTIER\tFILE")
+	for _, seg := range segments {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", seg.Time.Format(time.RFC3339), seg.Size, seg.Tier, seg.Path)
+		name := strings.TrimSuffix(filepath.Base(seg.Path), ".gz")
+		for i, p := range patterns[name] {
+			if i == *top {
+				break
+			}
+			fmt.Fprintf(tw, "\t%d\t\t%s\n", p.Count, p.Template)
+		}
+	}
+	return tw.Flush()
+}
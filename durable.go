@@ -0,0 +1,118 @@
+package rotwriter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DurableWriter is implemented by the writers returned by New. Use a type
+// assertion to access it.
+type DurableWriter interface {
+	io.Writer
+
+	// WriteDurable writes p like Write and returns a ticket that completes
+	// once p has been synced to disk. The syncs of concurrent durable
+	// writes are batched, so a single fsync may complete many tickets.
+	// After the file has been created or rotated, its directory is synced
+	// as well before the first ticket completes, so that the data is found
+	// under the file name after a crash.
+	WriteDurable(p []byte) (*Ticket, error)
+}
+
+// A Ticket reports the completion of a durable write.
+type Ticket struct {
+	done chan struct{}
+	err  error
+}
+
+// Wait blocks until the data of the write and the directory entry of the
+// file have been synced to disk and returns the error of the sync.
+func (t *Ticket) Wait() error {
+	<-t.done
+	return t.err
+}
+
+func (rw *rotateWriter) WriteDurable(p []byte) (*Ticket, error) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if _, err := rw.write(p); err != nil {
+		return nil, err
+	}
+
+	t := &Ticket{done: make(chan struct{})}
+	rw.pending = append(rw.pending, t)
+	if !rw.syncing {
+		rw.syncing = true
+		go rw.syncLoop()
+	}
+	return t, nil
+}
+
+// syncLoop syncs the file until no more tickets are pending. Tickets added
+// while a sync is running are completed by the next one.
+func (rw *rotateWriter) syncLoop() {
+	for {
+		rw.mutex.Lock()
+		tickets := rw.pending
+		rw.pending = nil
+		if len(tickets) == 0 {
+			rw.syncing = false
+			rw.mutex.Unlock()
+			return
+		}
+
+		// Holding syncMutex keeps a rotation from closing the file while
+		// it is being synced.
+		rw.syncMutex.Lock()
+		file := rw.file
+		dirty := rw.dirDirty
+		rw.dirDirty = false
+		rw.mutex.Unlock()
+
+		err := syncFile(file, dirty)
+		rw.syncMutex.Unlock()
+		if err != nil && dirty {
+			rw.mutex.Lock()
+			rw.dirDirty = true
+			rw.mutex.Unlock()
+		}
+		completeTickets(tickets, err)
+	}
+}
+
+// syncPending syncs the file for the pending tickets before the file is
+// being rotated. The caller must hold the mutex.
+func (rw *rotateWriter) syncPending() {
+	rw.syncMutex.Lock()
+	defer rw.syncMutex.Unlock()
+
+	if len(rw.pending) > 0 {
+		err := syncFile(rw.file, rw.dirDirty)
+		if err == nil {
+			rw.dirDirty = false
+		}
+		completeTickets(rw.pending, err)
+		rw.pending = nil
+	}
+}
+
+// syncFile syncs a file and, if its directory entry has changed since the
+// last sync (dirty), the directory.
+func syncFile(file *os.File, dirty bool) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if dirty {
+		return syncDir(filepath.Dir(file.Name()))
+	}
+	return nil
+}
+
+func completeTickets(tickets []*Ticket, err error) {
+	for _, t := range tickets {
+		t.err = err
+		close(t.done)
+	}
+}
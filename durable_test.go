@@ -0,0 +1,149 @@
+package rotwriter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteDurable(t *testing.T) {
+	// Rotated files are named by the second of the rotation, so every
+	// round rotates once only.
+	for i := 0; i < 20; i++ {
+		testWriteDurable(t)
+	}
+}
+
+func testWriteDurable(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(filename, 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw := w.(DurableWriter)
+
+	// Concurrent durable writes racing with the rotation: every ticket
+	// must complete exactly once (a second close of its channel panics).
+	const writers, writes = 20, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				ticket, err := dw.WriteDurable([]byte("0123456789\n"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := ticket.Wait(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got %d rotated files, want 1", len(segments))
+	}
+	var lines int
+	for _, name := range []string{segments[0].Path, filename} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines += bytes.Count(data, []byte("\n"))
+	}
+	if lines != writers*writes {
+		t.Errorf("got %d lines, want %d", lines, writers*writes)
+	}
+}
+
+func TestWriteDurableClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		w, err := New(filepath.Join(t.TempDir(), "app.log"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dw := w.(DurableWriter)
+
+		var tickets []*Ticket
+		for j := 0; j < 10; j++ {
+			ticket, err := dw.WriteDurable([]byte("line\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tickets = append(tickets, ticket)
+		}
+		if err := w.(io.Closer).Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Close completes the pending tickets, racing with the sync loop.
+		for _, ticket := range tickets {
+			select {
+			case <-ticket.done:
+				if ticket.err != nil {
+					t.Fatal(ticket.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("ticket not completed after Close")
+			}
+		}
+
+		if _, err := dw.WriteDurable([]byte("late\n")); err == nil {
+			t.Fatal("durable write after Close succeeded")
+		}
+	}
+}
+
+func TestWriteDurableSyncsDir(t *testing.T) {
+	w, err := New(filepath.Join(t.TempDir(), "app.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.(io.Closer).Close()
+	rw := w.(*rotateWriter)
+
+	dirDirty := func() bool {
+		rw.mutex.Lock()
+		defer rw.mutex.Unlock()
+		return rw.dirDirty
+	}
+	writeDurable := func() {
+		ticket, err := rw.WriteDurable([]byte("0123456789\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ticket.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The directory is synced for the first ticket after the creation and
+	// after a rotation.
+	writeDurable()
+	if dirDirty() {
+		t.Error("directory not synced after the creation")
+	}
+	w.Write([]byte("rotates\n"))
+	if !dirDirty() {
+		t.Fatal("rotation not noticed")
+	}
+	writeDurable()
+	if dirDirty() {
+		t.Error("directory not synced after the rotation")
+	}
+}
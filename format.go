@@ -0,0 +1,92 @@
+package rotwriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Format selects how the data passed to Write is being stored.
+type Format int
+
+const (
+	// Raw stores the data unchanged.
+	Raw Format = iota
+
+	// DockerJSON stores every line as a JSON object in the format of
+	// Docker's json-file logging driver.
+	DockerJSON
+
+	// CRI stores every line in the Kubernetes CRI log format.
+	CRI
+)
+
+const (
+	// MaxLineLength is the maximum length of a line in the DockerJSON and
+	// CRI formats. Longer lines are split into several partial lines
+	// (16 KB, the same as Docker's).
+	MaxLineLength = 16 * 1024
+)
+
+// WithFormat stores the written lines in the specified format. The stream
+// name (e.g. "stdout" or "stderr") is recorded with every line; it defaults
+// to "stdout". Every Write is expected to end on a line boundary. Data after
+// the last newline and lines longer than MaxLineLength are stored as partial
+// lines.
+func WithFormat(format Format, stream string) Option {
+	return func(rw *rotateWriter) {
+		if stream == "" {
+			stream = "stdout"
+		}
+		rw.format = format
+		rw.stream = stream
+	}
+}
+
+type dockerLine struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// encode converts p to the format of the writer.
+func (rw *rotateWriter) encode(p []byte, now time.Time) []byte {
+	var buf bytes.Buffer
+	stamp := now.UTC().Format(time.RFC3339Nano)
+
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		if len(line) > MaxLineLength {
+			line = line[:MaxLineLength]
+		}
+		p = p[len(line):]
+
+		full := line[len(line)-1] == '\n'
+		switch rw.format {
+		case DockerJSON:
+			// Docker keeps the newline of full lines in the log field.
+			data, _ := json.Marshal(dockerLine{string(line), rw.stream, stamp})
+			buf.Write(data)
+			buf.WriteByte('\n')
+		case CRI:
+			tag := "P"
+			if full {
+				tag = "F"
+				line = line[:len(line)-1]
+			}
+			buf.WriteString(stamp)
+			buf.WriteByte(' ')
+			buf.WriteString(rw.stream)
+			buf.WriteByte(' ')
+			buf.WriteString(tag)
+			buf.WriteByte(' ')
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Bytes()
+}
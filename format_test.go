@@ -0,0 +1,65 @@
+package rotwriter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeCRI(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	rw := &rotateWriter{}
+	WithFormat(CRI, "")(rw)
+
+	got := string(rw.encode([]byte("a\nb"), now))
+	want := "2020-01-02T03:04:05.000000006Z stdout F a\n2020-01-02T03:04:05.000000006Z stdout P b\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncodeDockerJSON(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rw := &rotateWriter{}
+	WithFormat(DockerJSON, "stderr")(rw)
+
+	long := strings.Repeat("x", MaxLineLength+3) + "\n"
+	lines := strings.Split(strings.TrimSuffix(string(rw.encode([]byte("a<\n"+long), now)), "\n"), "\n")
+	want := []string{"a<\n", strings.Repeat("x", MaxLineLength), "xxx\n"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		var got dockerLine
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Log != want[i] || got.Stream != "stderr" || got.Time != "2020-01-02T03:04:05Z" {
+			t.Errorf("line %d: got %+v", i, got)
+		}
+	}
+}
+
+func TestWriteFormat(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(filename, 0, WithFormat(CRI, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]byte("hello\n")); n != 6 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	w.(io.Closer).Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "Z stderr F hello\n") {
+		t.Errorf("got %q", data)
+	}
+}
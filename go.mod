@@ -0,0 +1,3 @@
+module github.com/perron2/rotwriter
+
+go 1.18
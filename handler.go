@@ -0,0 +1,141 @@
+package rotwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultMaxBytes is the request size limit of a Handler if no other
+	// limit is being specified (1 MB)
+	DefaultMaxBytes = 1024 * 1024
+)
+
+// Handler is an http.Handler accepting log lines via POST requests. The body
+// is written to the writer returned by Open for the key of the request. The
+// key is taken from the header named by KeyHeader or, if that is empty, from
+// the URL path without the leading slash.
+//
+// Bodies may be sent as plain text or as newline delimited JSON (content type
+// application/x-ndjson). Every line of an NDJSON body must be valid JSON. The
+// body may be gzip compressed (content encoding gzip). The whole body is
+// written with a single Write call and is terminated by a newline.
+type Handler struct {
+	// Open returns the writer for a key, e.g. the Writer method of a
+	// Manager.
+	Open func(key string) (io.Writer, error)
+
+	// KeyHeader names the request header holding the key.
+	KeyHeader string
+
+	// Authorize is called for every request before the body is being read.
+	// If it returns an error the request is rejected with status 401.
+	Authorize func(r *http.Request) error
+
+	// MaxBytes limits the size of the (uncompressed) body. If no limit is
+	// indicated (<=0) DefaultMaxBytes is used.
+	MaxBytes int64
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.Authorize != nil {
+		if err := h.Authorize(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if h.KeyHeader != "" {
+		key = r.Header.Get(h.KeyHeader)
+	}
+	maxBytes := h.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBytes)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) || int64(len(data)) > maxBytes {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-ndjson" || mediaType == "application/ndjson" {
+		data, err = normalizeNDJSON(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	// The writer is only opened for valid bodies, so rejected requests
+	// do not create files.
+	if len(data) > 0 {
+		out, err := h.Open(key)
+		if errors.Is(err, ErrInvalidKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := out.Write(data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeNDJSON validates every line of data and returns the non-empty
+// lines, each terminated by a newline.
+func normalizeNDJSON(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, errors.New("invalid JSON line")
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
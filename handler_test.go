@@ -0,0 +1,88 @@
+package rotwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func post(h *Handler, path, contentType, encoding string, body []byte) int {
+	r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func gzipped(data string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{Open: NewManager(dir, ".log", 0).Writer, MaxBytes: 100}
+
+	tests := []struct {
+		contentType, encoding string
+		body                  []byte
+		code                  int
+	}{
+		{"text/plain", "", []byte("hello"), 204},
+		{"application/x-ndjson", "", []byte("{\"a\":1}\n\n{\"b\":2}"), 204},
+		{"text/plain", "gzip", gzipped("zipped"), 204},
+		{"application/x-ndjson", "", []byte("{\"a\":1\n"), 400},
+		{"text/plain", "", []byte(strings.Repeat("x", 200)), 413},
+		{"text/plain", "gzip", gzipped(strings.Repeat("y", 500)), 413},
+		{"text/plain", "br", []byte("x"), 415},
+	}
+	for i, test := range tests {
+		if code := post(h, "/app", test.contentType, test.encoding, test.body); code != test.code {
+			t.Errorf("request %d: got status %d, want %d", i, code, test.code)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello\n{\"a\":1}\n{\"b\":2}\nzipped\n"; string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+func TestHandlerRejectedCreatesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{Open: NewManager(dir, ".log", 0).Writer}
+
+	if code := post(h, "/bad", "application/x-ndjson", "", []byte("{")); code != 400 {
+		t.Fatalf("got status %d", code)
+	}
+	if code := post(h, "/bad", "text/plain", "br", []byte("x")); code != 415 {
+		t.Fatalf("got status %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.log")); !os.IsNotExist(err) {
+		t.Errorf("rejected request created a file: %v", err)
+	}
+}
+
+func TestHandlerWrappedInvalidKey(t *testing.T) {
+	h := &Handler{Open: func(key string) (io.Writer, error) {
+		return nil, fmt.Errorf("open %q: %w", key, ErrInvalidKey)
+	}}
+	if code := post(h, "/x", "text/plain", "", []byte("x")); code != 400 {
+		t.Errorf("got status %d, want 400", code)
+	}
+}
@@ -0,0 +1,250 @@
+package rotwriter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Scheme is a naming scheme of rotated files.
+type Scheme int
+
+const (
+	// SchemeRotwriter is the naming scheme of this package
+	// (base-YYYYMMDD-HHMMSS.ext, or base-DIGEST.ext with WithContentNames).
+	SchemeRotwriter Scheme = iota + 1
+
+	// SchemeLogrotate is the naming scheme of logrotate, either numbered
+	// (name.1, name.2.gz) or dated (name-YYYYMMDD, name-YYYYMMDDHH). The
+	// extension option of logrotate (base.1.ext, base-YYYYMMDD.ext) is
+	// recognized as well.
+	SchemeLogrotate
+
+	// SchemeLumberjack is the naming scheme of lumberjack
+	// (base-2006-01-02T15-04-05.000.ext).
+	SchemeLumberjack
+)
+
+const lumberjackFormat = "2006-01-02T15-04-05.000"
+
+// String returns the lower case name of the scheme, e.g. "logrotate".
+func (s Scheme) String() string {
+	switch s {
+	case SchemeRotwriter:
+		return "rotwriter"
+	case SchemeLogrotate:
+		return "logrotate"
+	case SchemeLumberjack:
+		return "lumberjack"
+	}
+	return "Scheme(" + strconv.Itoa(int(s)) + ")"
+}
+
+// An Imported file is a rotated file found by Import.
+type Imported struct {
+	// Path is the location of the file when it has been found.
+	Path string
+
+	// NewPath is the location of the file after it has been renamed into
+	// the naming scheme of this package. It equals Path if the file has
+	// not been renamed.
+	NewPath string
+
+	// Scheme is the naming scheme the file has been recognized by.
+	Scheme Scheme
+
+	// Time is the time the file has been rotated. It is taken from the
+	// manifest, the name of the file or, for numbered files, the
+	// modification time. The manifest is not used for numbered files, as
+	// logrotate shifts their names with every rotation.
+	Time time.Time
+
+	// Compressed indicates a gzip compressed file.
+	Compressed bool
+
+	// number is the number of a numbered logrotate file. Higher numbers
+	// are older.
+	number uint64
+}
+
+// Import finds the files in the directory of filename that have been rotated
+// by logrotate, lumberjack or this package and returns them ordered by time.
+// If rename is true the files are renamed into the naming scheme of this
+// package, so that Segments, ApplyTiers and queries include them. Files
+// compressed by other means than gzip are not recognized.
+//
+// Every file found is recorded in the manifest (see ReadManifest) with its
+// time and scheme, unless an earlier import has recorded it with the same
+// time. Renamed files are recorded under their new name, with their previous
+// name as source.
+//
+// The new names of all files are determined before any file is renamed.
+// Files that would get the same name (e.g. numbered files with the same
+// modification time) or the name of an existing file are named by the next
+// free second instead; the manifest holds their exact time.
+func Import(filename string, rename bool) ([]Imported, error) {
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ReadManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []Imported
+	taken := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		taken[strings.TrimSuffix(name, ".gz")] = true
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		compressed := strings.HasSuffix(name, ".gz")
+		scheme, t, number, numbered := recognize(filepath.Base(filename), strings.TrimSuffix(name, ".gz"), info.ModTime())
+		if scheme == 0 {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if m, ok := findManifest(manifest, path); ok && !m.Time.IsZero() && !numbered {
+			t = m.Time
+		}
+		files = append(files, Imported{
+			Path:       path,
+			NewPath:    path,
+			Scheme:     scheme,
+			Time:       t,
+			Compressed: compressed,
+			number:     number,
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].Time.Equal(files[j].Time) {
+			return files[i].Time.Before(files[j].Time)
+		}
+		return files[i].number > files[j].number
+	})
+	if rename {
+		planNames(filename, files, taken)
+	}
+
+	for i := range files {
+		f := &files[i]
+		entry := ManifestEntry{
+			Name:   strings.TrimSuffix(filepath.Base(f.NewPath), ".gz"),
+			Time:   f.Time,
+			Scheme: f.Scheme.String(),
+		}
+		if f.NewPath != f.Path {
+			if err := os.Rename(f.Path, f.NewPath); err != nil {
+				f.NewPath = f.Path
+				return files, err
+			}
+			entry.Source = filepath.Base(f.Path)
+		} else if m, ok := findManifest(manifest, f.Path); ok && m.Scheme != "" && m.Time.Equal(f.Time) {
+			continue
+		}
+		if err := appendManifest(filename, entry); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// planNames sets the new paths of the files found by Import that are not
+// named by the scheme of this package. Taken holds the names (without .gz)
+// that must not be used.
+func planNames(filename string, files []Imported, taken map[string]bool) {
+	dir := filepath.Dir(filename)
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filepath.Base(filename), ext)
+	for i := range files {
+		f := &files[i]
+		if f.Scheme == SchemeRotwriter {
+			continue
+		}
+
+		t := f.Time.In(time.Local).Truncate(time.Second)
+		name := fmt.Sprintf("%s-%s%s", base, t.Format(stampFormat), ext)
+		for taken[name] {
+			t = t.Add(time.Second)
+			name = fmt.Sprintf("%s-%s%s", base, t.Format(stampFormat), ext)
+		}
+		taken[name] = true
+
+		f.NewPath = filepath.Join(dir, name)
+		if f.Compressed {
+			f.NewPath += ".gz"
+		}
+	}
+}
+
+// recognize returns the naming scheme, the rotation time and, for numbered
+// logrotate files, the number of the file name (without .gz) rotated from
+// the file current. The last result reports a numbered file.
+func recognize(current, name string, modTime time.Time) (Scheme, time.Time, uint64, bool) {
+	ext := filepath.Ext(current)
+	base := strings.TrimSuffix(current, ext)
+
+	// base-YYYYMMDD-HHMMSS.ext and base-2006-01-02T15-04-05.000.ext
+	if s, ok := between(name, base+"-", ext); ok {
+		if t, err := time.ParseInLocation(stampFormat, s, time.Local); err == nil {
+			return SchemeRotwriter, t, 0, false
+		}
+		if isDigest(s) {
+			return SchemeRotwriter, modTime, 0, false
+		}
+		if t, err := time.Parse(lumberjackFormat, s); err == nil {
+			return SchemeLumberjack, t, 0, false
+		}
+	}
+
+	// name.N and base.N.ext
+	s, ok := between(name, current+".", "")
+	if !ok && ext != "" {
+		s, ok = between(name, base+".", ext)
+	}
+	if ok && isNumber(s) {
+		n, _ := strconv.ParseUint(s, 10, 64)
+		return SchemeLogrotate, modTime, n, true
+	}
+
+	// name-YYYYMMDD[HH] and base-YYYYMMDD[HH].ext
+	s, ok = between(name, current+"-", "")
+	if !ok && ext != "" {
+		s, ok = between(name, base+"-", ext)
+	}
+	if ok && isNumber(s) {
+		for _, layout := range []string{"20060102", "2006010215"} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return SchemeLogrotate, t, 0, false
+			}
+		}
+	}
+
+	return 0, time.Time{}, 0, false
+}
+
+// between returns the part of s between prefix and suffix.
+func between(s, prefix, suffix string) (string, bool) {
+	if len(s) <= len(prefix)+len(suffix) || !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, suffix) {
+		return "", false
+	}
+	return s[len(prefix) : len(s)-len(suffix)], true
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
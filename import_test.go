@@ -0,0 +1,158 @@
+package rotwriter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	names := []string{
+		"app.log", "app.log.1", "app.log.2.gz", "app.log-20240101", "app.log-2024010212.gz",
+		"app-20240103.log", "app.4.log", "app-2024-01-05T10-00-00.000.log.gz",
+		"app-20240106-101010.log", "other.log.1", "app.log.x", "app-foo.log",
+	}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Date(2023, 12, 1, i, 0, 0, 0, time.Local)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	files, err := Import(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 8 {
+		t.Fatalf("got %d files, want 8", len(files))
+	}
+	for _, f := range files {
+		if f.NewPath != f.Path {
+			t.Errorf("%s renamed without rename", f.Path)
+		}
+	}
+
+	// Every file is recorded in the manifest once, even if imported again.
+	if _, err := Import(filename, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(manifestPath(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 8 {
+		t.Errorf("got %d manifest lines, want 8", n)
+	}
+	entries, err := ReadManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		entry, ok := findManifest(entries, f.Path)
+		if !ok || !entry.Time.Equal(f.Time) || entry.Scheme != f.Scheme.String() {
+			t.Errorf("%s: got manifest entry %+v", f.Path, entry)
+		}
+	}
+
+	files, err = Import(filename, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = ReadManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		entry, _ := findManifest(entries, f.NewPath)
+		if f.NewPath != f.Path && (entry.Source != filepath.Base(f.Path) || entry.Scheme != f.Scheme.String()) {
+			t.Errorf("%s: got manifest entry %+v", f.NewPath, entry)
+		}
+	}
+	segments, err := Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 8 {
+		t.Fatalf("got %d segments, want 8", len(segments))
+	}
+}
+
+func TestImportCollisions(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+
+	// Lumberjack files of the same second, numbered files copied without
+	// their modification times, and an existing rotated file of the same
+	// second.
+	mtime := time.Date(2024, 1, 5, 10, 0, 0, 0, time.Local)
+	names := []string{
+		"app-2024-01-05T10-00-00.000.log", "app-2024-01-05T10-00-00.500.log",
+		"app.log.1", "app.log.2", "app.log.3.gz",
+		"app-" + mtime.Format(stampFormat) + ".log",
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	files, err := Import(filename, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(names) {
+		t.Fatalf("got %d files, want %d", len(files), len(names))
+	}
+
+	// Every file has been renamed to a distinct name and keeps its
+	// content; the existing file has not been touched.
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if seen[f.NewPath] {
+			t.Errorf("%s imported twice", f.NewPath)
+		}
+		seen[f.NewPath] = true
+		data, err := os.ReadFile(f.NewPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != filepath.Base(f.Path) {
+			t.Errorf("%s holds %q", f.NewPath, data)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, names[5])); string(data) != names[5] {
+		t.Errorf("existing file overwritten with %q", data)
+	}
+
+	// Segments orders the files by the times recorded in the manifest and
+	// files of the same time by their new names: the existing file, the
+	// numbered files from the oldest, then the lumberjack files.
+	segments, err := Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	entries, _ := ReadManifest(filename)
+	for _, seg := range segments {
+		entry, _ := findManifest(entries, seg.Path)
+		sources = append(sources, entry.Source)
+	}
+	want := []string{"", "app.log.3.gz", "app.log.2", "app.log.1", "app-2024-01-05T10-00-00.000.log", "app-2024-01-05T10-00-00.500.log"}
+	if !sort.SliceIsSorted(segments, func(i, j int) bool { return segments[i].Time.Before(segments[j].Time) }) {
+		t.Error("segments not ordered by time")
+	}
+	for i := range want {
+		if i >= len(sources) || sources[i] != want[i] {
+			t.Fatalf("got sources %q, want %q", sources, want)
+		}
+	}
+}
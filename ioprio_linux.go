@@ -0,0 +1,31 @@
+package rotwriter
+
+import "syscall"
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// setIOPriority sets the I/O priority of the current thread and returns a
+// function restoring the previous priority.
+func setIOPriority(class IOClass, level int) (restore func() error, err error) {
+	prev, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	prio := uintptr(class)<<ioprioClassShift | uintptr(level&7)
+	_, _, errno = syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prio)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return func() error {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prev)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,43 @@
+package rotwriter
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func threadIOPriority(t *testing.T) uintptr {
+	prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	return prio
+}
+
+func TestRunTaskIOPriority(t *testing.T) {
+	SetThrottle(TaskSeal, Throttle{IOClass: IOClassIdle})
+	defer SetThrottle(TaskSeal, Throttle{})
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	before := threadIOPriority(t)
+
+	var during uintptr
+	err := runTask(TaskSeal, func() error {
+		prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+		during = prio
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class := IOClass(during >> ioprioClassShift); class != IOClassIdle {
+		t.Errorf("task ran with class %d, want %d", class, IOClassIdle)
+	}
+	if after := threadIOPriority(t); after != before {
+		t.Errorf("priority of the calling thread changed from %#x to %#x", before, after)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package rotwriter
+
+// setIOPriority does nothing on systems other than Linux.
+func setIOPriority(class IOClass, level int) (restore func() error, err error) {
+	return func() error { return nil }, nil
+}
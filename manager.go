@@ -0,0 +1,237 @@
+package rotwriter
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidKey is returned by a Manager for keys that cannot be used as a
+// file name.
+var ErrInvalidKey = errors.New("rotwriter: invalid key")
+
+// Manager hands out rotate writers selected by a key. Each key writes to its
+// own file in a common directory. The writers are created on first use and
+// kept open for later calls, unless a limit is set by SetMaxWriters.
+type Manager struct {
+	mutex      sync.Mutex
+	dir        string
+	ext        string
+	maxSize    int64
+	opts       []Option
+	maxWriters int
+	writers    map[string]*openWriter
+	closing    map[string]chan struct{}
+	uses       uint64
+	err        error
+}
+
+// openWriter is an open rotate writer of a Manager.
+type openWriter struct {
+	w     io.Writer
+	users int
+	used  uint64
+}
+
+// NewManager creates a manager that stores the files in the specified
+// directory. The file for a key is named after the key followed by the
+// extension (e.g. ".log"). The maximum size and the options are used as in
+// New for every writer.
+func NewManager(dir, ext string, maxSize int64, opts ...Option) *Manager {
+	return &Manager{
+		dir:     dir,
+		ext:     ext,
+		maxSize: maxSize,
+		opts:    opts,
+		writers: make(map[string]*openWriter),
+		closing: make(map[string]chan struct{}),
+	}
+}
+
+// SetMaxWriters limits the number of writers kept open at the same time.
+// When the limit is reached, the least recently used writer is closed before
+// another one is opened; it is opened again on its next write. Writers in
+// the middle of a write are not closed, so the limit may be exceeded for a
+// short time. If no limit is indicated (<=0) all writers are kept open.
+func (m *Manager) SetMaxWriters(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.maxWriters = n
+}
+
+// Writer returns the rotate writer for the specified key. Keys may only
+// contain letters, digits, dots, dashes and underscores. Keys ending in the
+// name suffix of rotated files (a dash followed by a timestamp or digest) are
+// rejected, as their files would be taken for rotated files of another key.
+// The returned writer implements DurableWriter.
+func (m *Manager) Writer(key string) (io.Writer, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	ow, err := m.acquire(key)
+	if err != nil {
+		return nil, err
+	}
+	m.release(ow)
+	return &managedWriter{m: m, key: key}, nil
+}
+
+// acquire returns the open writer of a key, opening it if necessary, and
+// marks it as being used until release is called.
+func (m *Manager) acquire(key string) (*openWriter, error) {
+	evicted := make(map[string]io.Writer)
+	defer func() {
+		for key, w := range evicted {
+			m.closeWriter(key, w)
+		}
+	}()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// A writer closed due to the limit may still be finishing rotations,
+	// which a new writer for the same file would take for interrupted ones.
+	for m.closing[key] != nil {
+		done := m.closing[key]
+		m.mutex.Unlock()
+		<-done
+		m.mutex.Lock()
+	}
+
+	m.uses++
+	if ow, ok := m.writers[key]; ok {
+		ow.users++
+		ow.used = m.uses
+		return ow, nil
+	}
+
+	for m.maxWriters > 0 && len(m.writers) >= m.maxWriters {
+		lru := ""
+		for k, ow := range m.writers {
+			if ow.users == 0 && (lru == "" || ow.used < m.writers[lru].used) {
+				lru = k
+			}
+		}
+		if lru == "" {
+			break
+		}
+		evicted[lru] = m.writers[lru].w
+		m.closing[lru] = make(chan struct{})
+		delete(m.writers, lru)
+	}
+
+	w, err := New(filepath.Join(m.dir, key+m.ext), m.maxSize, m.opts...)
+	if err != nil {
+		return nil, err
+	}
+	ow := &openWriter{w: w, users: 1, used: m.uses}
+	m.writers[key] = ow
+	return ow, nil
+}
+
+func (m *Manager) release(ow *openWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ow.users--
+}
+
+// closeWriter closes the writer of a key due to the limit. The first error
+// is returned by Close.
+func (m *Manager) closeWriter(key string, w io.Writer) {
+	var err error
+	if c, ok := w.(io.Closer); ok {
+		err = c.Close()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+	close(m.closing[key])
+	delete(m.closing, key)
+}
+
+// Close closes the writers of all keys and returns the first error, which
+// includes errors of writers closed earlier due to the limit. Later calls of
+// Writer create new writers.
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for len(m.closing) > 0 {
+		for _, done := range m.closing {
+			m.mutex.Unlock()
+			<-done
+			m.mutex.Lock()
+			break
+		}
+	}
+
+	err := m.err
+	m.err = nil
+	for key, ow := range m.writers {
+		if c, ok := ow.w.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+		delete(m.writers, key)
+	}
+	return err
+}
+
+// managedWriter is the writer of a key handed out by a Manager. It opens the
+// rotate writer of the key again if it has been closed due to the limit.
+type managedWriter struct {
+	m   *Manager
+	key string
+}
+
+func (mw *managedWriter) Write(p []byte) (int, error) {
+	ow, err := mw.m.acquire(mw.key)
+	if err != nil {
+		return 0, err
+	}
+	defer mw.m.release(ow)
+	return ow.w.Write(p)
+}
+
+func (mw *managedWriter) WriteDurable(p []byte) (*Ticket, error) {
+	ow, err := mw.m.acquire(mw.key)
+	if err != nil {
+		return nil, err
+	}
+	defer mw.m.release(ow)
+	return ow.w.(DurableWriter).WriteDurable(p)
+}
+
+func validKey(key string) bool {
+	if key == "" || strings.Trim(key, ".") == "" {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+
+	for i := strings.IndexByte(key, '-'); i >= 0; i = strings.IndexByte(key, '-') {
+		key = key[i+1:]
+		suffix := key
+		if j := strings.IndexByte(suffix, '.'); j >= 0 {
+			suffix = suffix[:j]
+		}
+		if _, err := time.Parse(stampFormat, suffix); err == nil || isDigest(suffix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package rotwriter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidKey(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"app", true},
+		{"web-01.example.com", true},
+		{"app-2020", true},
+		{"app-20200101", true},
+		{"app_" + digest, true},
+		{"", false},
+		{"..", false},
+		{"a/b", false},
+		{"app log", false},
+		{"app-20200101-000000", false},
+		{"app-20200101-000000.log", false},
+		{"app-20200101-000000.log.gz", false},
+		{"x-app-20200101-000000", false},
+		{"app-" + digest, false},
+		{"app-" + digest + ".log", false},
+	}
+	for _, test := range tests {
+		if valid := validKey(test.key); valid != test.valid {
+			t.Errorf("validKey(%q) = %v, want %v", test.key, valid, test.valid)
+		}
+	}
+}
+
+func TestManagerKeyNotRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, ".log", 0)
+
+	if _, err := m.Writer("app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Writer("app-20200101-000000"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("got %v, want ErrInvalidKey", err)
+	}
+	if _, err := m.Writer("app-2020.01"); err != nil {
+		t.Fatal(err)
+	}
+
+	tiers := []Tier{{Dir: filepath.Join(dir, "old"), Retention: 2 * time.Hour}}
+	if err := ApplyTiers(filepath.Join(dir, "app.log"), tiers); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.log", "app-2020.01.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestManagerClose(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, ".log", 0, WithMark(20*time.Millisecond, ""))
+	for _, key := range []string{"a", "b"} {
+		if _, err := m.Writer(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for _, key := range []string{"a", "b"} {
+		data, err := os.ReadFile(filepath.Join(dir, key+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 0 {
+			t.Errorf("%s: closed writer wrote %q", key, data)
+		}
+	}
+
+	w, err := m.Writer("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("again\n")); err != nil {
+		t.Error(err)
+	}
+	m.Close()
+}
+
+func TestManagerMaxWriters(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, ".log", 0)
+	m.SetMaxWriters(2)
+	defer m.Close()
+
+	writers := make(map[string]io.Writer)
+	for _, key := range []string{"a", "b", "c", "a", "d", "b"} {
+		w, ok := writers[key]
+		if !ok {
+			var err error
+			if w, err = m.Writer(key); err != nil {
+				t.Fatal(err)
+			}
+			writers[key] = w
+		}
+		if _, err := w.Write([]byte(key + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(m.writers); n > 2 {
+			t.Fatalf("%d writers open", n)
+		}
+	}
+
+	// The least recently used writers have been closed: "a" for "c", "b"
+	// for "a", "c" for "d" and "a" for "b".
+	if _, ok := m.writers["b"]; !ok {
+		t.Error("writer b is not open")
+	}
+	if _, ok := m.writers["c"]; ok {
+		t.Error("writer c is still open")
+	}
+
+	want := map[string]string{"a": "a\na\n", "b": "b\nb\n", "c": "c\n", "d": "d\n"}
+	for key, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, key+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: got %q, want %q", key, data, content)
+		}
+	}
+}
+
+func TestManagerMaxWritersConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, ".log", 0)
+	m.SetMaxWriters(3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		key := strconv.Itoa(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := m.Writer(key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for j := 0; j < 100; j++ {
+				if _, err := w.Write([]byte(key + "\n")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		key := strconv.Itoa(i)
+		data, err := os.ReadFile(filepath.Join(dir, key+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Repeat(key+"\n", 100); string(data) != want {
+			t.Errorf("%s: got %d bytes, want %d", key, len(data), len(want))
+		}
+	}
+}
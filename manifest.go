@@ -0,0 +1,151 @@
+package rotwriter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ManifestEntry records a rotated file in the manifest of a rotate writer.
+// The manifest is stored next to the current file (with the additional
+// extension .manifest) and holds an entry for each rotated file whose name
+// does not tell its exact rotation time, for each file found by Import, as
+// well as the metadata recorded by SummarizeFile.
+type ManifestEntry struct {
+	// Name is the base name of the rotated file (without .gz).
+	Name string `json:"name"`
+
+	// Time is the time the file has been rotated.
+	Time time.Time `json:"time"`
+
+	// Patterns are the top patterns of the file recorded by SummarizeFile.
+	Patterns []Pattern `json:"patterns,omitempty"`
+
+	// Source is the name of the file before it has been renamed by Import.
+	Source string `json:"source,omitempty"`
+
+	// Scheme is the name of the naming scheme Import has recognized the
+	// file by (see Scheme.String).
+	Scheme string `json:"scheme,omitempty"`
+
+	// TimeName is the name a file named by its content (see
+	// WithContentNames) would have been given without content names, i.e.
+	// with the rotation time inserted before the extension.
+	TimeName string `json:"time_name,omitempty"`
+}
+
+// merge adds the fields set in other to the entry.
+func (e *ManifestEntry) merge(other ManifestEntry) {
+	if e.Time.IsZero() {
+		e.Time = other.Time
+	}
+	if other.Patterns != nil {
+		e.Patterns = other.Patterns
+	}
+	if other.Source != "" {
+		e.Source = other.Source
+	}
+	if other.Scheme != "" {
+		e.Scheme = other.Scheme
+	}
+	if other.TimeName != "" {
+		e.TimeName = other.TimeName
+	}
+}
+
+var manifestMutex sync.Mutex
+
+func manifestPath(filename string) string {
+	return filename + ".manifest"
+}
+
+// appendManifest adds an entry to the manifest of the rotate writer for
+// filename. Each entry is appended with a single write.
+func appendManifest(filename string, entry ManifestEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	file, err := os.OpenFile(manifestPath(filename), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadManifest returns the entries of the manifest of the rotate writer for
+// filename in the order they have been added. Entries of the same file with
+// the same or no time are merged into one. A file rotated several times under
+// the same name (see WithContentNames) has an entry for each rotation.
+// Incomplete entries, e.g. of a crash while writing, are skipped.
+func ReadManifest(filename string) ([]ManifestEntry, error) {
+	file, err := os.Open(manifestPath(filename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []ManifestEntry
+	latest := make(map[string]int)
+	s := bufio.NewScanner(file)
+	s.Buffer(nil, 1024*1024*1024)
+	for s.Scan() {
+		var entry ManifestEntry
+		if json.Unmarshal(s.Bytes(), &entry) != nil || entry.Name == "" {
+			continue
+		}
+		if i, ok := latest[entry.Name]; ok && (entry.Time.IsZero() || entry.Time.Equal(entries[i].Time)) {
+			entries[i].merge(entry)
+			continue
+		}
+		latest[entry.Name] = len(entries)
+		entries = append(entries, entry)
+	}
+	return entries, s.Err()
+}
+
+// findManifest returns the entry of a rotated file (given by its path) from
+// the entries of a manifest.
+func findManifest(entries []ManifestEntry, path string) (ManifestEntry, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Name == name {
+			return entries[i], true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// rotatedFrom returns the name of the current file a rotated file (in the
+// directory of the rotate writer) has been rotated from, and the rotation
+// time if it is part of the name.
+func rotatedFrom(name string) (filename string, t time.Time, ok bool) {
+	dir, base := filepath.Split(strings.TrimSuffix(name, ".gz"))
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	if n := len(stem) - len(stampFormat) - 1; n > 0 && stem[n] == '-' {
+		if t, err := time.ParseInLocation(stampFormat, stem[n+1:], time.Local); err == nil {
+			return filepath.Join(dir, stem[:n]+ext), t, true
+		}
+	}
+	if n := len(stem) - 2*sha256.Size - 1; n > 0 && stem[n] == '-' && isDigest(stem[n+1:]) {
+		return filepath.Join(dir, stem[:n]+ext), time.Time{}, true
+	}
+	return "", time.Time{}, false
+}
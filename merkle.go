@@ -0,0 +1,204 @@
+package rotwriter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNoRecord is returned by ProveRecord if a file has no record with the
+// requested index.
+var ErrNoRecord = errors.New("rotwriter: no such record")
+
+// A MerkleProof proves that a record is part of a rotated file with a known
+// Merkle tree root. The tree is built over the lines of the file as
+// specified in RFC 6962. Each record is a line including its line ending, and
+// a last line without newline is a record as well, so that the records cover
+// the exact bytes of the file.
+type MerkleProof struct {
+	// Record is the line being proven, including its line ending.
+	Record []byte
+
+	// Index is the position of the line in the file, starting at 0.
+	Index int
+
+	// Size is the number of lines in the file.
+	Size int
+
+	// Path holds the hashes of the audit path from the leaf to the root.
+	Path [][]byte
+}
+
+// Verify checks that the proof leads from the record to the root.
+func (p *MerkleProof) Verify(root []byte) bool {
+	if p.Index < 0 || p.Index >= p.Size {
+		return false
+	}
+
+	fn, sn := p.Index, p.Size-1
+	r := leafHash(p.Record)
+	for _, h := range p.Path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(h, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, h)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// SealMerkle computes the Merkle tree root over the lines of a rotated file
+// and stores it next to the file (with the additional extension .merkle).
+// It can be used with WithPostRotate:
+//
+//	rotwriter.WithPostRotate(rotwriter.SealMerkle)
+func SealMerkle(name string) error {
+	return runTask(TaskSeal, func() error {
+		leaves, err := readLeaves(name, TaskSeal)
+		if err != nil {
+			return err
+		}
+
+		data := fmt.Sprintf("%d %x\n", len(leaves), merkleRoot(leaves))
+		return os.WriteFile(sidecarPath(name, ".merkle"), []byte(data), 0666)
+	})
+}
+
+// MerkleRoot returns the Merkle tree root and the number of records stored
+// for a rotated file by SealMerkle.
+func MerkleRoot(name string) (root []byte, size int, err error) {
+	data, err := os.ReadFile(sidecarPath(name, ".merkle"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var hexRoot string
+	if _, err := fmt.Sscanf(string(data), "%d %s", &size, &hexRoot); err != nil {
+		return nil, 0, err
+	}
+	root, err = hex.DecodeString(hexRoot)
+	return root, size, err
+}
+
+// ProveRecord returns the inclusion proof for the record with the specified
+// index of a rotated file.
+func ProveRecord(name string, index int) (*MerkleProof, error) {
+	file, err := openSegment(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	proof := &MerkleProof{Index: index}
+	var leaves [][]byte
+	s := recordScanner(file)
+	for s.Scan() {
+		if len(leaves) == index {
+			proof.Record = append([]byte(nil), s.Bytes()...)
+		}
+		leaves = append(leaves, leafHash(s.Bytes()))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(leaves) {
+		return nil, ErrNoRecord
+	}
+
+	proof.Size = len(leaves)
+	proof.Path = merklePath(index, leaves)
+	return proof, nil
+}
+
+func readLeaves(name string, task Task) ([][]byte, error) {
+	file, err := openSegment(name, task)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var leaves [][]byte
+	s := recordScanner(file)
+	for s.Scan() {
+		leaves = append(leaves, leafHash(s.Bytes()))
+	}
+	return leaves, s.Err()
+}
+
+// recordScanner returns a scanner for the records of a file. Unlike
+// bufio.ScanLines the records keep their line endings.
+func recordScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024*1024)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return i + 1, data[:i+1], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	return s
+}
+
+func leafHash(record []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(record)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+func merklePath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(merklePath(index, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merklePath(index-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
@@ -0,0 +1,142 @@
+package rotwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMerkleProofs(t *testing.T) {
+	dir := t.TempDir()
+	for n := 1; n <= 20; n++ {
+		name := filepath.Join(dir, fmt.Sprintf("app-%d.log", n))
+		var data []byte
+		for i := 0; i < n; i++ {
+			data = append(data, fmt.Sprintf("line %d\n", i)...)
+		}
+		if err := os.WriteFile(name, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := SealMerkle(name); err != nil {
+			t.Fatal(err)
+		}
+		root, size, err := MerkleRoot(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != n {
+			t.Fatalf("got size %d, want %d", size, n)
+		}
+
+		var records []byte
+		for i := 0; i < n; i++ {
+			proof, err := ProveRecord(name, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proof.Verify(root) {
+				t.Errorf("n=%d: proof of record %d does not verify", n, i)
+			}
+			records = append(records, proof.Record...)
+
+			forged := *proof
+			forged.Record = []byte("forged\n")
+			if forged.Verify(root) {
+				t.Errorf("n=%d: forged record %d verifies", n, i)
+			}
+			forged = *proof
+			forged.Index = (i + 1) % n
+			if n > 1 && forged.Verify(root) {
+				t.Errorf("n=%d: proof of record %d verifies at index %d", n, i, forged.Index)
+			}
+		}
+		if !bytes.Equal(records, data) {
+			t.Errorf("n=%d: records %q do not cover the file %q", n, records, data)
+		}
+
+		if _, err := ProveRecord(name, n); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("n=%d: got %v, want ErrNoRecord", n, err)
+		}
+	}
+}
+
+func TestMerkleExactBytes(t *testing.T) {
+	dir := t.TempDir()
+	contents := []string{"x\ny\n", "x\r\ny", "x\ny", "x\r\ny\n", "x\n\ny\n"}
+	roots := make(map[string]string)
+	for i, content := range contents {
+		name := filepath.Join(dir, fmt.Sprintf("app-%d.log", i))
+		if err := os.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := SealMerkle(name); err != nil {
+			t.Fatal(err)
+		}
+		root, _, err := MerkleRoot(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, ok := roots[string(root)]; ok {
+			t.Errorf("%q and %q have the same root", content, other)
+		}
+		roots[string(root)] = content
+	}
+
+	proof, err := ProveRecord(filepath.Join(dir, "app-1.log"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(proof.Record) != "y" {
+		t.Errorf("got record %q, want %q", proof.Record, "y")
+	}
+}
+
+func TestMerkleCompressed(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	seg := filepath.Join(dir, "app-"+time.Now().Add(-2*time.Hour).Format(stampFormat)+".log")
+	if err := os.WriteFile(seg, []byte("a\nb\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := SealMerkle(seg); err != nil {
+		t.Fatal(err)
+	}
+
+	tiers := []Tier{{Dir: filepath.Join(dir, "old"), Age: time.Hour, Compress: true}}
+	if err := ApplyTiers(filename, tiers); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := Segments(filename, tiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || !segments[0].Compressed {
+		t.Fatalf("got %+v, want one compressed segment", segments)
+	}
+
+	f, err := os.Open(segments[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := gzip.NewReader(f); err != nil {
+		t.Fatal(err)
+	}
+
+	root, _, err := MerkleRoot(segments[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ProveRecord(segments[0].Path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proof.Verify(root) || string(proof.Record) != "b\n" {
+		t.Errorf("proof of %q does not verify after compression", proof.Record)
+	}
+}
@@ -0,0 +1,312 @@
+package rotwriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// A Predicate selects records of JSON lines files. Fields are addressed by
+// their name, with the names of nested objects separated by dots (e.g.
+// "request.status").
+type Predicate func(record map[string]interface{}) bool
+
+// Equal selects records whose field equals value. Numbers are compared by
+// their value regardless of their type.
+func Equal(field string, value interface{}) Predicate {
+	return func(record map[string]interface{}) bool {
+		v, ok := lookup(record, field)
+		if !ok {
+			return false
+		}
+		a, aok := number(v)
+		b, bok := number(value)
+		if aok || bok {
+			return aok && bok && a == b
+		}
+		return reflect.DeepEqual(v, value)
+	}
+}
+
+// Range selects records whose field lies between min and max (inclusive).
+// Both bounds must either be numbers or strings; a nil bound is unbounded.
+func Range(field string, min, max interface{}) Predicate {
+	return func(record map[string]interface{}) bool {
+		v, ok := lookup(record, field)
+		if !ok {
+			return false
+		}
+		if min != nil {
+			if c, ok := compare(v, min); !ok || c < 0 {
+				return false
+			}
+		}
+		if max != nil {
+			if c, ok := compare(v, max); !ok || c > 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Match selects records whose field matches re. Fields that are no strings
+// are matched in their JSON encoding.
+func Match(field string, re *regexp.Regexp) Predicate {
+	return func(record map[string]interface{}) bool {
+		v, ok := lookup(record, field)
+		if !ok {
+			return false
+		}
+		if s, ok := v.(string); ok {
+			return re.MatchString(s)
+		}
+		data, _ := json.Marshal(v)
+		return re.Match(data)
+	}
+}
+
+// Exists selects records having the field, even if it is null.
+func Exists(field string) Predicate {
+	return func(record map[string]interface{}) bool {
+		_, ok := lookup(record, field)
+		return ok
+	}
+}
+
+// A Query selects records from the files of a rotate writer holding JSON
+// lines. Lines that are no JSON objects are skipped.
+type Query struct {
+	// Predicates must all match for a record to be selected.
+	Predicates []Predicate
+
+	// From and To restrict the query to the files written during this
+	// time range. A zero time is unbounded.
+	From, To time.Time
+
+	// Fields selects the fields of the records being returned. If no
+	// fields are indicated the whole records are returned.
+	Fields []string
+
+	// Tiers are the tiers the rotated files may be stored in.
+	Tiers []Tier
+}
+
+// Run calls fn for every selected record of the rotated files and the
+// current file of the rotate writer for filename, ordered by time. If Fields
+// is set the records passed to fn only hold these fields, with the dotted
+// field names as keys.
+func (q *Query) Run(filename string, fn func(record map[string]interface{}) error) error {
+	segments, err := Segments(filename, q.Tiers)
+	if err != nil {
+		return err
+	}
+
+	// A file holds the records written between the rotation of the
+	// previous file and its own rotation.
+	var start time.Time
+	for _, seg := range segments {
+		if q.overlaps(start, seg.Time) {
+			if err := q.scan(seg.Open, fn); err != nil {
+				return err
+			}
+		}
+		start = seg.Time
+	}
+
+	if !q.overlaps(start, time.Now()) {
+		return nil
+	}
+	err = q.scan(func() (io.ReadCloser, error) { return os.Open(filename) }, fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// WriteJSON writes the selected records of the files of the rotate writer
+// for filename to w, one JSON object per line. The fields are written in the
+// order of Fields.
+func (q *Query) WriteJSON(w io.Writer, filename string) error {
+	return q.Run(filename, func(record map[string]interface{}) error {
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, key := range q.keys(record) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(key)
+			v, err := json.Marshal(record[key])
+			if err != nil {
+				return err
+			}
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(v)
+		}
+		buf.WriteString("}\n")
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// WriteTable writes the selected records of the files of the rotate writer
+// for filename to w as a table with one column per field. If no fields are
+// indicated the fields of the first record are used.
+func (q *Query) WriteTable(w io.Writer, filename string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	columns := q.Fields
+	if columns != nil {
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+	}
+	err := q.Run(filename, func(record map[string]interface{}) error {
+		if columns == nil {
+			columns = q.keys(record)
+			fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		}
+		cells := make([]string, len(columns))
+		for i, key := range columns {
+			if v, ok := record[key]; ok {
+				cells[i] = tableCell(v)
+			}
+		}
+		_, err := fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// overlaps reports whether the time range from start to end overlaps the
+// time range of the query.
+func (q *Query) overlaps(start, end time.Time) bool {
+	return (q.From.IsZero() || !end.Before(q.From)) && (q.To.IsZero() || start.IsZero() || !start.After(q.To))
+}
+
+func (q *Query) scan(open func() (io.ReadCloser, error), fn func(record map[string]interface{}) error) error {
+	file, err := open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	s.Buffer(nil, 1024*1024*1024)
+lines:
+	for s.Scan() {
+		var record map[string]interface{}
+		if json.Unmarshal(s.Bytes(), &record) != nil || record == nil {
+			continue
+		}
+		for _, p := range q.Predicates {
+			if !p(record) {
+				continue lines
+			}
+		}
+
+		if q.Fields != nil {
+			selected := make(map[string]interface{}, len(q.Fields))
+			for _, field := range q.Fields {
+				if v, ok := lookup(record, field); ok {
+					selected[field] = v
+				}
+			}
+			record = selected
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// keys returns the keys of a record in the order of Fields or sorted if no
+// fields are indicated.
+func (q *Query) keys(record map[string]interface{}) []string {
+	var keys []string
+	if q.Fields != nil {
+		for _, field := range q.Fields {
+			if _, ok := record[field]; ok {
+				keys = append(keys, field)
+			}
+		}
+		return keys
+	}
+
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func tableCell(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// lookup returns the value of a dotted field of a record.
+func lookup(record map[string]interface{}, field string) (interface{}, bool) {
+	var v interface{} = record
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// number returns the value of a number of any type as float64.
+func number(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// compare compares two numbers or two strings.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	x, aok := a.(string)
+	y, bok := b.(string)
+	if !aok || !bok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
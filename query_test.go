@@ -0,0 +1,91 @@
+package rotwriter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeQueryFiles(t *testing.T) (filename string, rotated time.Time) {
+	dir := t.TempDir()
+	filename = filepath.Join(dir, "app.log")
+	rotated = time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	old := `{"level":"error","req":{"status":500},"msg":"old"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "app-"+rotated.Format(stampFormat)+".log"), []byte(old), 0666); err != nil {
+		t.Fatal(err)
+	}
+	current := `{"level":"error","req":{"status":503},"msg":"timeout db"}
+not json
+{"level":"info","req":{"status":200},"msg":"ok"}
+{"level":"error","msg":"no req"}
+`
+	if err := os.WriteFile(filename, []byte(current), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return filename, rotated
+}
+
+func TestQueryJSON(t *testing.T) {
+	filename, _ := writeQueryFiles(t)
+	q := &Query{
+		Predicates: []Predicate{
+			Equal("level", "error"),
+			Range("req.status", 500, nil),
+			Match("msg", regexp.MustCompile("time")),
+		},
+		Fields: []string{"msg", "req.status"},
+	}
+	var buf bytes.Buffer
+	if err := q.WriteJSON(&buf, filename); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"msg":"timeout db","req.status":503}` + "\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	filename, rotated := writeQueryFiles(t)
+	tests := []struct {
+		from, to time.Time
+		msgs     string
+	}{
+		{time.Time{}, time.Time{}, "old timeout db ok no req"},
+		{time.Now().Add(-time.Hour), time.Time{}, "timeout db ok no req"},
+		{time.Time{}, rotated.Add(-time.Hour), "old"},
+	}
+	for _, test := range tests {
+		q := &Query{Predicates: []Predicate{Exists("msg")}, From: test.from, To: test.to}
+		var msgs []string
+		err := q.Run(filename, func(record map[string]interface{}) error {
+			msgs = append(msgs, record["msg"].(string))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(msgs, " "); got != test.msgs {
+			t.Errorf("from %v to %v: got %q, want %q", test.from, test.to, got, test.msgs)
+		}
+	}
+}
+
+func TestQueryTable(t *testing.T) {
+	filename, _ := writeQueryFiles(t)
+	q := &Query{
+		Predicates: []Predicate{Exists("req.status"), Range("req.status", nil, 503)},
+		Fields:     []string{"level", "req.status"},
+	}
+	var buf bytes.Buffer
+	if err := q.WriteTable(&buf, filename); err != nil {
+		t.Fatal(err)
+	}
+	want := "LEVEL  REQ.STATUS\nerror  500\nerror  503\ninfo   200\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
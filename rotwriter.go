@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,14 +25,107 @@ type rotateWriter struct {
 	filename string
 	file     *os.File
 	maxSize  int64
+	format   Format
+	stream   string
+
+	preRotate    func(size int64) bool
+	maxDelay     time.Duration
+	maxOvershoot int64
+	dueSince     time.Time
+	postRotate   []func(name string) error
+	hookError    func(name string, err error)
+	hookErr      error
+	hooks        sync.WaitGroup
+	lastRotation chan struct{}
+	contentNames bool
+	markInterval time.Duration
+	markText     string
+	markTimer    *time.Timer
+	lastWrite    time.Time
+
+	syncMutex sync.Mutex
+	pending   []*Ticket
+	syncing   bool
+	dirDirty  bool // directory changed since the last sync
+}
+
+// An Option configures optional behavior of a rotate writer.
+type Option func(rw *rotateWriter)
+
+// WithContentNames names rotated files by the hex encoded SHA-256 digest of
+// their content instead of a timestamp. Rotating a file with the same content
+// as an existing one replaces the existing file. The rotation time is recorded
+// in the manifest (see ReadManifest). The digest is computed in the goroutine
+// of the post rotate functions, before they are called; meanwhile the file
+// has a temporary name. Files left under a temporary name by a crash are
+// named by their content when the next writer for the file is created, using
+// their modification time as the rotation time. Empty temporary files are
+// removed.
+func WithContentNames() Option {
+	return func(rw *rotateWriter) {
+		rw.contentNames = true
+	}
+}
+
+// WithMark writes a line holding the current time and the specified text
+// (by default "-- MARK --") after the writer has been idle for the specified
+// interval, and again after each further interval without writes.
+func WithMark(interval time.Duration, text string) Option {
+	return func(rw *rotateWriter) {
+		if text == "" {
+			text = "-- MARK --"
+		}
+		rw.markInterval = interval
+		rw.markText = text
+	}
+}
+
+// WithPreRotate registers a function that is called with the current file
+// size when a rotation is due. If it returns false the rotation is postponed
+// to a later write, but at most for maxDelay and as long as the file does not
+// exceed the maximum size by more than maxOvershoot bytes. The function must
+// not write to the rotate writer.
+func WithPreRotate(hook func(size int64) bool, maxDelay time.Duration, maxOvershoot int64) Option {
+	return func(rw *rotateWriter) {
+		rw.preRotate = hook
+		rw.maxDelay = maxDelay
+		rw.maxOvershoot = maxOvershoot
+	}
+}
+
+// WithPostRotate registers a function that is called with the name of the
+// rotated file after each rotation. The functions run one after another in
+// the order of their registration, in a goroutine of their own, and for one
+// rotation after the other.
+// Errors are passed to the function registered by WithPostRotateError. Close
+// waits for running functions.
+//
+// ApplyTiers may move or delete a rotated file while the functions are still
+// running, leaving their sidecar files behind. Either register ApplyTiers as
+// the last function, or use tiers whose age exceeds the duration of the
+// functions by far.
+func WithPostRotate(hook func(name string) error) Option {
+	return func(rw *rotateWriter) {
+		rw.postRotate = append(rw.postRotate, hook)
+	}
+}
+
+// WithPostRotateError registers a function that is called with the name of
+// the rotated file and the error of a failed post rotate function (or of
+// naming the file by its content). If no function is registered Close
+// returns the first error.
+func WithPostRotateError(handler func(name string, err error)) Option {
+	return func(rw *rotateWriter) {
+		rw.hookError = handler
+	}
 }
 
 // New creates a new rotate writer based on the specified file name. The file
 // being rotated whenever the maximum size is being reached. If no maximum size
 // is indicated (<=0) a default size of 10 MB is used. The rotated files use
 // the same file name as the main file with an additional timestamp inserted
-// before the extension.
-func New(filename string, maxSize int64) (io.Writer, error) {
+// before the extension. Further behavior can be configured by options.
+func New(filename string, maxSize int64, opts ...Option) (io.Writer, error) {
 	if maxSize <= 0 {
 		maxSize = DefaultSize
 	}
@@ -45,19 +139,56 @@ func New(filename string, maxSize int64) (io.Writer, error) {
 		filename: filename,
 		file:     file,
 		maxSize:  maxSize,
+		dirDirty: true,
+	}
+	for _, opt := range opts {
+		opt(rw)
+	}
+	if rw.contentNames {
+		if err := rw.recoverRotations(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if rw.markInterval > 0 {
+		rw.mutex.Lock()
+		rw.lastWrite = time.Now()
+		rw.markTimer = time.AfterFunc(rw.markInterval, rw.mark)
+		rw.mutex.Unlock()
 	}
 
 	return rw, nil
 }
 
 func (rw *rotateWriter) Write(p []byte) (n int, err error) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	return rw.write(p)
+}
+
+func (rw *rotateWriter) write(p []byte) (n int, err error) {
+	rw.lastWrite = time.Now()
+
 	stat, err := rw.file.Stat()
-	if err == nil && stat.Size() > rw.maxSize {
+	if err == nil && rotationDue(stat.Size(), rw.maxSize) && !rw.postpone(stat.Size()) {
+		rw.dueSince = time.Time{}
+		rw.syncPending()
 		rw.file.Close()
 
+		now := time.Now()
 		ext := filepath.Ext(rw.file.Name())
 		base := strings.TrimSuffix(rw.file.Name(), ext)
-		name := fmt.Sprintf("%s-%s%s", base, time.Now().Format("20060102-150405"), ext)
+		name := fmt.Sprintf("%s-%s%s", base, now.Format(stampFormat), ext)
+		if rw.contentNames {
+			// Rotations of the same second must not replace each
+			// other before the digest is known.
+			name, err = reserveName(base, ext)
+			if err != nil {
+				return 0, err
+			}
+		}
 
 		err = os.Rename(rw.file.Name(), name)
 		if err != nil {
@@ -68,7 +199,219 @@ func (rw *rotateWriter) Write(p []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
+		rw.dirDirty = true
+
+		if rw.contentNames || len(rw.postRotate) > 0 {
+			done := make(chan struct{})
+			rw.hooks.Add(1)
+			go rw.finishRotation(name, now, rw.lastRotation, done)
+			rw.lastRotation = done
+		}
+	}
+
+	if rw.format == Raw {
+		return rw.file.Write(p)
+	}
+
+	_, err = rw.file.Write(rw.encode(p, time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close stops writing MARK lines, syncs the file for pending durable writes,
+// closes the file and waits for running post rotate functions. The writer
+// returned by New implements io.Closer.
+func (rw *rotateWriter) Close() error {
+	rw.mutex.Lock()
+	if rw.markTimer != nil {
+		rw.markTimer.Stop()
+		rw.markTimer = nil
+	}
+	rw.syncPending()
+	err := rw.file.Close()
+	rw.mutex.Unlock()
+
+	// No rotation can start after the file has been closed.
+	rw.hooks.Wait()
+	if err == nil {
+		rw.mutex.Lock()
+		err = rw.hookErr
+		rw.mutex.Unlock()
+	}
+	return err
+}
+
+// finishRotation names a file rotated with content names by its digest and
+// calls the post rotate functions. It waits for the previous rotation to be
+// finished (prev) and closes done when it is finished itself.
+func (rw *rotateWriter) finishRotation(name string, t time.Time, prev, done chan struct{}) {
+	defer rw.hooks.Done()
+	defer close(done)
+	if prev != nil {
+		<-prev
+	}
+
+	if rw.contentNames {
+		var err error
+		name, err = rw.nameByContent(name, t)
+		if err != nil {
+			rw.hookFailed(name, err)
+		}
 	}
 
-	return rw.file.Write(p)
+	for _, hook := range rw.postRotate {
+		if err := hook(name); err != nil {
+			rw.hookFailed(name, err)
+		}
+	}
+}
+
+// nameByContent renames a file rotated at time t from its temporary name to
+// its digest and records it in the manifest. If the file cannot be read it
+// is named by the rotation time instead.
+func (rw *rotateWriter) nameByContent(tmp string, t time.Time) (string, error) {
+	ext := filepath.Ext(rw.filename)
+	base := strings.TrimSuffix(rw.filename, ext)
+
+	var digest []byte
+	err := runTask(TaskSeal, func() (err error) {
+		digest, err = contentDigest(tmp, TaskSeal)
+		return err
+	})
+	if err != nil {
+		name := fmt.Sprintf("%s-%s%s", base, t.Format(stampFormat), ext)
+		if rerr := os.Rename(tmp, name); rerr != nil {
+			return tmp, rerr
+		}
+		return name, err
+	}
+
+	name := fmt.Sprintf("%s-%x%s", base, digest, ext)
+	if err := os.Rename(tmp, name); err != nil {
+		return tmp, err
+	}
+	return name, appendManifest(rw.filename, ManifestEntry{
+		Name:     filepath.Base(name),
+		Time:     t,
+		TimeName: fmt.Sprintf("%s-%s%s", filepath.Base(base), t.Format(stampFormat), ext),
+	})
+}
+
+// hookFailed reports the error of a post rotate function.
+func (rw *rotateWriter) hookFailed(name string, err error) {
+	if rw.hookError != nil {
+		rw.hookError(name, err)
+		return
+	}
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	if rw.hookErr == nil {
+		rw.hookErr = err
+	}
+}
+
+// reserveName creates an empty file with a unique temporary name for a file
+// being rotated.
+func reserveName(base, ext string) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(base), filepath.Base(base)+"-*"+ext+".tmp")
+	if err != nil {
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
+
+// recoverRotations finishes the rotations interrupted by a crash, whose files
+// still have the temporary name of reserveName.
+func (rw *rotateWriter) recoverRotations() error {
+	dir := filepath.Dir(rw.filename)
+	ext := filepath.Ext(rw.filename)
+	prefix := strings.TrimSuffix(filepath.Base(rw.filename), ext) + "-"
+	suffix := ext + ".tmp"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type tmpFile struct {
+		path string
+		t    time.Time
+	}
+	var files []tmpFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		// The random part of a temporary name consists of digits only.
+		if strings.Trim(name[len(prefix):len(name)-len(suffix)], "0123456789") != "" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name)
+		if info.Size() == 0 {
+			// The crash happened before the file has been renamed.
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		files = append(files, tmpFile{path, info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].t.Before(files[j].t) })
+	for _, f := range files {
+		done := make(chan struct{})
+		rw.hooks.Add(1)
+		go rw.finishRotation(f.path, f.t, rw.lastRotation, done)
+		rw.lastRotation = done
+	}
+	return nil
+}
+
+// mark writes a MARK line if the writer has been idle for the mark interval
+// and schedules the next check.
+func (rw *rotateWriter) mark() {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.markTimer == nil {
+		return
+	}
+
+	idle := time.Since(rw.lastWrite)
+	if idle >= rw.markInterval {
+		rw.write([]byte(time.Now().Format(time.RFC3339) + " " + rw.markText + "\n"))
+		idle = 0
+	}
+	rw.markTimer.Reset(rw.markInterval - idle)
+}
+
+// postpone reports whether a due rotation is being postponed by the pre
+// rotate hook.
+func (rw *rotateWriter) postpone(size int64) bool {
+	if rw.preRotate == nil {
+		return false
+	}
+
+	now := time.Now()
+	if rw.dueSince.IsZero() {
+		rw.dueSince = now
+	}
+	if now.Sub(rw.dueSince) >= rw.maxDelay || size-rw.maxSize > rw.maxOvershoot {
+		return false
+	}
+	return !rw.preRotate(size)
+}
+
+// rotationDue reports whether a file of the specified size has to be rotated
+// before the next write.
+func rotationDue(size, maxSize int64) bool {
+	return size > maxSize
 }
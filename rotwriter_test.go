@@ -0,0 +1,337 @@
+package rotwriter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPostRotate(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	tiers := []Tier{{Dir: filepath.Join(dir, "old"), Age: 0}}
+
+	var mutex sync.Mutex
+	var calls []string
+	errHook := errors.New("hook failed")
+	var reported error
+	w, err := New(filename, 1,
+		WithPostRotate(func(name string) error {
+			time.Sleep(50 * time.Millisecond)
+			mutex.Lock()
+			calls = append(calls, "seal")
+			mutex.Unlock()
+			return SealMerkle(name)
+		}),
+		WithPostRotate(func(name string) error {
+			mutex.Lock()
+			calls = append(calls, "fail")
+			mutex.Unlock()
+			return errHook
+		}),
+		WithPostRotate(func(name string) error {
+			mutex.Lock()
+			calls = append(calls, "tiers")
+			mutex.Unlock()
+			return ApplyTiers(filename, tiers)
+		}),
+		WithPostRotateError(func(name string, err error) {
+			mutex.Lock()
+			reported = err
+			mutex.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close has waited for the hooks, which ran in order.
+	if len(calls) != 3 || calls[0] != "seal" || calls[1] != "fail" || calls[2] != "tiers" {
+		t.Errorf("got calls %v", calls)
+	}
+	if reported != errHook {
+		t.Errorf("got reported error %v", reported)
+	}
+
+	// The sidecar has been written before the file was moved.
+	segments, err := Segments(filename, tiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].Tier != 1 {
+		t.Fatalf("got %+v, want one segment in the tier", segments)
+	}
+	if _, _, err := MerkleRoot(segments[0].Path); err != nil {
+		t.Error(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.merkle")); len(matches) != 0 {
+		t.Errorf("sidecars left behind: %v", matches)
+	}
+}
+
+func TestPostRotateErrorOnClose(t *testing.T) {
+	errHook := errors.New("hook failed")
+	w, err := New(filepath.Join(t.TempDir(), "app.log"), 1,
+		WithPostRotate(func(name string) error { return errHook }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if err := w.(io.Closer).Close(); err != errHook {
+		t.Errorf("got %v, want the error of the hook", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w, err := New(filename, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("abcd"))
+	w.Write([]byte("ef"))
+	w.(io.Closer).Close()
+
+	segments, err := Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got %d rotated files, want 1", len(segments))
+	}
+	for name, want := range map[string]string{segments[0].Path: "abcd", filename: "ef"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s: got %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestContentNames(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w, err := New(filename, 3, WithContentNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"abcd\n", "abcd\n", "efgh\n", "ijkl\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotations of the same second with different content are kept, the
+	// same content replaces the earlier file.
+	segments, err := Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("got %d rotated files, want 2", len(segments))
+	}
+	for _, seg := range segments {
+		if err := VerifyContentName(seg.Path); err != nil {
+			t.Errorf("%s: %v", seg.Path, err)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+
+	// Both rotations of the same content are recorded in the manifest,
+	// and the time does not depend on the modification time.
+	entries, err := ReadManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Name != entries[1].Name {
+		t.Fatalf("got manifest %+v", entries)
+	}
+	for _, entry := range entries {
+		if want := "app-" + entry.Time.Format(stampFormat) + ".log"; entry.TimeName != want {
+			t.Errorf("got time name %q, want %q", entry.TimeName, want)
+		}
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	for _, seg := range segments {
+		os.Chtimes(seg.Path, old, old)
+	}
+	segments, err = Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !segments[0].Time.Equal(entries[1].Time) || !segments[1].Time.Equal(entries[2].Time) {
+		t.Errorf("got times %v and %v, want %v and %v", segments[0].Time, segments[1].Time, entries[1].Time, entries[2].Time)
+	}
+
+	// Files missing in the manifest fall back to the modification time.
+	forged := filepath.Join(dir, "app-"+strings.Repeat("0", 64)+".log")
+	if err := os.WriteFile(forged, []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(forged, old, old)
+	segments, err = Segments(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segments[0].Path != forged || !segments[0].Time.Equal(old) {
+		t.Errorf("got %+v, want %s first", segments[0], forged)
+	}
+	if err := VerifyContentName(forged); err != ErrDigestMismatch {
+		t.Errorf("got %v, want ErrDigestMismatch", err)
+	}
+}
+
+func TestContentNamesRecover(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	files := map[string]string{
+		"app-123456.log.tmp":   "rotated\n",
+		"app-789.log.tmp":      "",
+		"app-x-123.log.tmp":    "other\n",
+		"app-123456.other.tmp": "other\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+	}
+
+	var rotated []string
+	w, err := New(filename, 0, WithContentNames(), WithPostRotate(func(name string) error {
+		rotated = append(rotated, name)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rotated file is named by its content, the empty one is removed
+	// and the files of other names are kept.
+	if len(rotated) != 1 {
+		t.Fatalf("got rotated files %v", rotated)
+	}
+	if err := VerifyContentName(rotated[0]); err != nil {
+		t.Error(err)
+	}
+	kept := map[string]bool{"app-x-123.log.tmp": true, "app-123456.other.tmp": true}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept[name] {
+			t.Errorf("%s: got %v, want kept %v", name, err, kept[name])
+		}
+	}
+
+	entries, err := ReadManifest(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != filepath.Base(rotated[0]) || !entries[0].Time.Equal(old) {
+		t.Errorf("got manifest %+v", entries)
+	}
+}
+
+func TestPreRotate(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	allow := false
+	w, err := New(filepath.Join(dir, "app.log"), 10, WithPreRotate(func(size int64) bool {
+		calls++
+		return allow
+	}, time.Hour, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.(io.Closer).Close()
+	rotated := func() int {
+		matches, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+		return len(matches)
+	}
+
+	w.Write([]byte("0123456789x"))
+	for i := 0; i < 3; i++ {
+		// Due, but postponed while the overshoot is at most 25 bytes.
+		w.Write([]byte("0123456789"))
+	}
+	if rotated() != 0 || calls != 3 {
+		t.Fatalf("got %d rotations and %d calls, want 0 and 3", rotated(), calls)
+	}
+
+	// An overshoot of 31 bytes rotates without asking.
+	w.Write([]byte("x"))
+	if rotated() != 1 || calls != 3 {
+		t.Fatalf("got %d rotations and %d calls, want 1 and 3", rotated(), calls)
+	}
+
+	// Rotated files are named by the second of the rotation, so the
+	// second rotation is told by the size of the current file.
+	w.Write([]byte("0123456789x"))
+	allow = true
+	w.Write([]byte("x"))
+	info, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 1 || calls != 4 {
+		t.Fatalf("got size %d and %d calls, want 1 and 4", info.Size(), calls)
+	}
+}
+
+func TestMark(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(filename, 0, WithMark(50*time.Millisecond, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("busy\n"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 6 || strings.Count(string(data), "busy") != 5 {
+		t.Fatalf("got %q, want 5 busy lines and MARK lines", data)
+	}
+	for _, line := range lines[5:] {
+		if !strings.HasSuffix(line, " -- MARK --") {
+			t.Errorf("got %q, want a MARK line", line)
+		}
+	}
+
+	// No MARK lines are written after Close.
+	time.Sleep(100 * time.Millisecond)
+	if after, _ := os.ReadFile(filename); len(after) != len(data) {
+		t.Errorf("closed writer wrote %q", after[len(data):])
+	}
+}
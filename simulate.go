@@ -0,0 +1,155 @@
+package rotwriter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A TraceWrite is a single write of a recorded write trace.
+type TraceWrite struct {
+	Time time.Time
+	Size int64
+}
+
+// A Policy holds the rotation and retention settings to be simulated.
+type Policy struct {
+	// MaxSize is the maximum size as passed to New.
+	MaxSize int64
+
+	// Tiers are the tiers as passed to ApplyTiers.
+	Tiers []Tier
+
+	// TierInterval is the interval ApplyTiers is being called with. If no
+	// interval is indicated (<=0) ApplyTiers is called after each rotation.
+	TierInterval time.Duration
+
+	// CompressRatio is the size of compressed files relative to their
+	// original size. If no ratio is indicated (<=0) compression does not
+	// change the size.
+	CompressRatio float64
+}
+
+// A SimSegment is a rotated file of a simulation.
+type SimSegment struct {
+	Segment
+
+	// Deleted is the time the file has been deleted or zero if it has been
+	// kept.
+	Deleted time.Time
+}
+
+// Usage is the disk space used at a certain time of a simulation.
+type Usage struct {
+	Time time.Time
+
+	// Bytes holds the number of bytes used per tier, with the current file
+	// and the rotated files in the directory of the writer at index 0.
+	Bytes []int64
+}
+
+// A Simulation is the result of Simulate.
+type Simulation struct {
+	// Segments holds all files rotated during the simulation, including
+	// deleted ones, ordered by time.
+	Segments []SimSegment
+
+	// Usage holds the disk space used after every change.
+	Usage []Usage
+
+	// Deletions holds the files deleted during the simulation in the order
+	// of deletion.
+	Deletions []SimSegment
+}
+
+// Simulate replays a write trace against a rotate writer for filename with
+// the specified policy, using the same rotation and tiering rules as New and
+// ApplyTiers. No files are being written.
+func Simulate(filename string, trace []TraceWrite, policy Policy) *Simulation {
+	if policy.MaxSize <= 0 {
+		policy.MaxSize = DefaultSize
+	}
+	trace = append([]TraceWrite(nil), trace...)
+	sort.SliceStable(trace, func(i, j int) bool {
+		return trace[i].Time.Before(trace[j].Time)
+	})
+
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	sim := &Simulation{}
+	var size int64
+	var nextTiering time.Time
+
+	usage := func(now time.Time) {
+		bytes := make([]int64, len(policy.Tiers)+1)
+		bytes[0] = size
+		for _, seg := range sim.Segments {
+			if seg.Deleted.IsZero() {
+				bytes[seg.Tier] += seg.Size
+			}
+		}
+		if n := len(sim.Usage); n > 0 && sim.Usage[n-1].Time.Equal(now) {
+			sim.Usage[n-1].Bytes = bytes
+		} else {
+			sim.Usage = append(sim.Usage, Usage{now, bytes})
+		}
+	}
+
+	tiering := func(now time.Time) {
+		for i := range sim.Segments {
+			seg := &sim.Segments[i]
+			if !seg.Deleted.IsZero() {
+				continue
+			}
+
+			target, remove := tierAction(now.Sub(seg.Time), seg.Tier, policy.Tiers)
+			if remove {
+				seg.Deleted = now
+				sim.Deletions = append(sim.Deletions, *seg)
+			} else if target != seg.Tier {
+				tier := policy.Tiers[target-1]
+				seg.Path = filepath.Join(tier.Dir, filepath.Base(seg.Path))
+				seg.Tier = target
+				if tier.Compress && !seg.Compressed {
+					seg.Path += ".gz"
+					seg.Compressed = true
+					if policy.CompressRatio > 0 {
+						seg.Size = int64(float64(seg.Size) * policy.CompressRatio)
+					}
+				}
+			}
+		}
+		usage(now)
+	}
+
+	for _, w := range trace {
+		if policy.TierInterval > 0 {
+			if nextTiering.IsZero() {
+				nextTiering = w.Time.Add(policy.TierInterval)
+			}
+			for !w.Time.Before(nextTiering) {
+				tiering(nextTiering)
+				nextTiering = nextTiering.Add(policy.TierInterval)
+			}
+		}
+
+		if rotationDue(size, policy.MaxSize) {
+			name := fmt.Sprintf("%s-%s%s", base, w.Time.Format(stampFormat), ext)
+			sim.Segments = append(sim.Segments, SimSegment{
+				Segment: Segment{Path: name, Time: w.Time, Size: size},
+			})
+			size = 0
+			if policy.TierInterval <= 0 {
+				tiering(w.Time)
+			}
+		}
+
+		size += w.Size
+		usage(w.Time)
+	}
+
+	return sim
+}
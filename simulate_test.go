@@ -0,0 +1,83 @@
+package rotwriter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var trace []TraceWrite
+	for i := 47; i >= 0; i-- {
+		// The trace is ordered by Simulate.
+		trace = append(trace, TraceWrite{start.Add(time.Duration(i) * time.Hour), 60})
+	}
+	policy := Policy{
+		MaxSize: 100,
+		Tiers: []Tier{
+			{Dir: "/hdd", Age: 6 * time.Hour, Compress: true},
+			{Dir: "/archive", Age: 12 * time.Hour, Retention: 24 * time.Hour},
+		},
+		CompressRatio: 0.5,
+	}
+	sim := Simulate("/var/log/app.log", trace, policy)
+
+	// Every second write rotates a file of 120 bytes.
+	if len(sim.Segments) != 23 {
+		t.Fatalf("got %d segments, want 23", len(sim.Segments))
+	}
+	first := sim.Segments[0]
+	if first.Path != "/archive/app-20240101-020000.log.gz" || first.Size != 60 || !first.Compressed {
+		t.Errorf("got first segment %+v", first)
+	}
+	if want := start.Add(26 * time.Hour); !first.Deleted.Equal(want) {
+		t.Errorf("first segment deleted at %v, want %v", first.Deleted, want)
+	}
+
+	// Files are deleted 24 hours after their rotation, in order.
+	if len(sim.Deletions) != 11 {
+		t.Fatalf("got %d deletions, want 11", len(sim.Deletions))
+	}
+	for _, seg := range sim.Deletions {
+		if age := seg.Deleted.Sub(seg.Time); age != 24*time.Hour {
+			t.Errorf("%s deleted at age %v", seg.Path, age)
+		}
+	}
+
+	last := sim.Usage[len(sim.Usage)-1]
+	if !last.Time.Equal(start.Add(47*time.Hour)) || len(last.Bytes) != 3 {
+		t.Fatalf("got last usage %+v", last)
+	}
+	if last.Bytes[0] != 3*120+120 || last.Bytes[1] != 3*60 || last.Bytes[2] != 6*60 {
+		t.Errorf("got last usage %v", last.Bytes)
+	}
+}
+
+func TestSimulateTierInterval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trace := []TraceWrite{
+		{start, 200},
+		{start.Add(time.Minute), 200},
+		{start.Add(3 * time.Hour), 10},
+	}
+	policy := Policy{
+		MaxSize:      100,
+		Tiers:        []Tier{{Dir: "/hdd", Age: 30 * time.Minute}},
+		TierInterval: time.Hour,
+	}
+	sim := Simulate("app.log", trace, policy)
+
+	// The segment rotated at 00:01 moves at the first tiering at 01:00.
+	if len(sim.Segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(sim.Segments))
+	}
+	for _, u := range sim.Usage {
+		if u.Time.Equal(start.Add(time.Hour)) {
+			if u.Bytes[0] != 200 || u.Bytes[1] != 200 {
+				t.Errorf("got usage %v at 01:00", u.Bytes)
+			}
+			return
+		}
+	}
+	t.Error("no tiering at 01:00")
+}
@@ -0,0 +1,105 @@
+package rotwriter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A Pattern is a line template together with the number of lines matching
+// it.
+type Pattern struct {
+	Template string `json:"template"`
+	Count    int    `json:"count"`
+}
+
+// masks replace the variable parts of a line, in this order.
+var masks = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*\d[0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*\d[0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<num>"},
+}
+
+// Template returns the template of a line, with timestamps, UUIDs, IP
+// addresses, hex values and numbers replaced by placeholders.
+func Template(line string) string {
+	for _, m := range masks {
+		line = m.re.ReplaceAllString(line, m.placeholder)
+	}
+	return line
+}
+
+// Summarize groups the lines read from r by their template and returns the
+// top most frequent patterns ordered by count.
+func Summarize(r io.Reader, top int) ([]Pattern, error) {
+	counts := make(map[string]int)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024*1024)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			counts[Template(line)]++
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	patterns := make([]Pattern, 0, len(counts))
+	for template, count := range counts {
+		patterns = append(patterns, Pattern{template, count})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].Template < patterns[j].Template
+	})
+	if top > 0 && len(patterns) > top {
+		patterns = patterns[:top]
+	}
+	return patterns, nil
+}
+
+// SummarizeFile records the top patterns of a rotated file in the manifest of
+// its rotate writer (see ReadManifest). The file must still be stored in the
+// directory of the rotate writer. It can be used with WithPostRotate:
+//
+//	rotwriter.WithPostRotate(func(name string) error {
+//		return rotwriter.SummarizeFile(name, 20)
+//	})
+func SummarizeFile(name string, top int) error {
+	filename, t, ok := rotatedFrom(name)
+	if !ok {
+		return fmt.Errorf("rotwriter: %s is no rotated file", name)
+	}
+
+	return runTask(TaskSeal, func() error {
+		file, err := openSegment(name, TaskSeal)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		patterns, err := Summarize(file, top)
+		if err != nil {
+			return err
+		}
+		if patterns == nil {
+			patterns = []Pattern{}
+		}
+		return appendManifest(filename, ManifestEntry{
+			Name:     strings.TrimSuffix(filepath.Base(name), ".gz"),
+			Time:     t,
+			Patterns: patterns,
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package rotwriter
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct{ line, template string }{
+		{"2024-01-02T03:04:05.123Z GET /users/123 took 45.2ms", "<time> GET /users/<num> took <num>ms"},
+		{"request 550e8400-e29b-41d4-a716-446655440000 failed", "request <uuid> failed"},
+		{"connect from 10.0.0.1:5555", "connect from <ip>"},
+		{"error at 0x1F in deadbeef12", "error at <hex> in <hex>"},
+		{"user42 in decade", "user<num> in decade"},
+	}
+	for _, test := range tests {
+		if template := Template(test.line); template != test.template {
+			t.Errorf("Template(%q) = %q, want %q", test.line, template, test.template)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	in := "conn 1 ok\nconn 2 ok\nconn 3 ok\nerror at 0xff\n\nerror at 0x10\nstart\n"
+	patterns, err := Summarize(strings.NewReader(in), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pattern{{"conn <num> ok", 3}, {"error at <hex>", 2}}
+	if len(patterns) != len(want) || patterns[0] != want[0] || patterns[1] != want[1] {
+		t.Errorf("got %v, want %v", patterns, want)
+	}
+}
+
+func TestSummarizeFile(t *testing.T) {
+	for _, contentNames := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "app.log")
+		opts := []Option{WithPostRotate(func(name string) error {
+			return SummarizeFile(name, 1)
+		})}
+		if contentNames {
+			opts = append(opts, WithContentNames())
+		}
+		w, err := New(filename, 10, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("conn 1 ok\nconn 2 ok\nstart\n"))
+		w.Write([]byte("next\n"))
+		if err := w.(io.Closer).Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		segments, err := Segments(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := ReadManifest(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segments) != 1 || len(entries) != 1 {
+			t.Fatalf("got segments %v and manifest %v", segments, entries)
+		}
+		entry, ok := findManifest(entries, segments[0].Path)
+		if !ok {
+			t.Fatalf("%s missing in the manifest", segments[0].Path)
+		}
+		if !entry.Time.Equal(segments[0].Time) {
+			t.Errorf("got time %v, want %v", entry.Time, segments[0].Time)
+		}
+		if len(entry.Patterns) != 1 || entry.Patterns[0] != (Pattern{"conn <num> ok", 2}) {
+			t.Errorf("got patterns %v", entry.Patterns)
+		}
+	}
+
+	if err := SummarizeFile(filepath.Join(t.TempDir(), "app.log"), 1); err == nil {
+		t.Error("summarized a file that has not been rotated")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package rotwriter
+
+import "os"
+
+// syncDir syncs a directory, so that the creation and renaming of its
+// entries survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
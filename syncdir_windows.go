@@ -0,0 +1,7 @@
+package rotwriter
+
+// syncDir does nothing on Windows, where directories cannot be synced and
+// the entries are made durable by the file system.
+func syncDir(dir string) error {
+	return nil
+}
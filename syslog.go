@@ -0,0 +1,255 @@
+package rotwriter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxMessage is the maximum syslog message size of a SyslogServer
+	// if no other size is being specified (64 KB)
+	DefaultMaxMessage = 64 * 1024
+
+	// DefaultIdleTimeout is the time after which a SyslogServer closes an
+	// idle TCP connection if no other timeout is being specified (5 minutes)
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// SyslogServer receives syslog messages (RFC 3164 and RFC 5424) and writes
+// each message as a line to the writer returned by Open for the sending
+// host. The host is taken from the HOSTNAME field of the message. If the
+// message carries no usable host name the IP address of the sender is used.
+// Control characters within a message, e.g. the newlines of a multi-line
+// message, are escaped as '#' followed by their octal code (as rsyslog
+// does), so that each message stays on a single line.
+type SyslogServer struct {
+	// Open returns the writer for a host, e.g. the Writer method of a
+	// Manager.
+	Open func(host string) (io.Writer, error)
+
+	// AllowHost reports whether messages may be stored under a host name
+	// taken from a message. As the name is not verified, this prevents
+	// spoofed names from creating files. Messages of other hosts are stored
+	// under the IP address of the sender. If nil, all names are allowed.
+	AllowHost func(host string) bool
+
+	// MaxMessage limits the size of a single message. Longer messages are
+	// truncated (UDP) or rejected by closing the connection (TCP). If no
+	// size is indicated (<=0) DefaultMaxMessage is used.
+	MaxMessage int
+
+	// IdleTimeout is the time a TCP connection may stay without receiving
+	// a complete message before it is closed. If no timeout is indicated
+	// (<=0) DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// ErrorLog receives messages that could not be written and malformed
+	// TCP frames. If nil, errors are logged via the log package's standard
+	// logger.
+	ErrorLog *log.Logger
+}
+
+// ServeUDP reads datagrams from conn until it is closed. Each datagram holds
+// a single message.
+func (s *SyslogServer) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, s.maxMessage())
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		s.handle(buf[:n], addr)
+	}
+}
+
+// ServeTCP accepts connections from l until it is closed. Messages on a
+// connection may either be octet counted or terminated by a newline
+// (RFC 6587).
+func (s *SyslogServer) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *SyslogServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := s.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	r := bufio.NewReaderSize(conn, 4096)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return
+		}
+		msg, err := s.readFrame(r)
+		if err == errFrameTooLarge || err == errBadFrame {
+			s.logf("%v from %s", err, conn.RemoteAddr())
+		}
+		if err != nil {
+			return
+		}
+		s.handle(msg, conn.RemoteAddr())
+	}
+}
+
+var (
+	errFrameTooLarge = errors.New("rotwriter: syslog frame too large")
+	errBadFrame      = errors.New("rotwriter: malformed syslog frame")
+)
+
+// maxCountDigits limits the length of the octet count of a frame.
+const maxCountDigits = 10
+
+// readFrame reads the next message of a TCP stream.
+func (s *SyslogServer) readFrame(r *bufio.Reader) ([]byte, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if c >= '1' && c <= '9' {
+		// The count is read digit by digit, so that neither a missing
+		// space nor a huge count makes the frame being buffered.
+		size := int(c - '0')
+		for digits := 1; ; digits++ {
+			if size > s.maxMessage() {
+				return nil, errFrameTooLarge
+			}
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' || digits == maxCountDigits {
+				return nil, errBadFrame
+			}
+			size = size*10 + int(c-'0')
+		}
+		msg := make([]byte, size)
+		_, err = io.ReadFull(r, msg)
+		return msg, err
+	}
+
+	r.UnreadByte()
+	var msg []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		msg = append(msg, line...)
+		if len(msg) > s.maxMessage() {
+			return nil, errFrameTooLarge
+		}
+		if err == nil || (err == io.EOF && len(msg) > 0) {
+			return msg, nil
+		} else if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
+
+func (s *SyslogServer) handle(msg []byte, addr net.Addr) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if len(msg) == 0 {
+		return
+	}
+
+	host := syslogHost(msg)
+	if !validKey(host) || (s.AllowHost != nil && !s.AllowHost(host)) {
+		host = addrHost(addr)
+	}
+
+	w, err := s.Open(host)
+	if err == nil {
+		_, err = w.Write(escapeControl(msg))
+	}
+	if err != nil {
+		s.logf("rotwriter: syslog message from %s (%s) lost: %v", host, addr, err)
+	}
+}
+
+func (s *SyslogServer) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// escapeControl returns msg terminated by a newline, with the control
+// characters other than tab replaced by '#' and their three digit octal
+// code.
+func escapeControl(msg []byte) []byte {
+	buf := make([]byte, 0, len(msg)+1)
+	for _, c := range msg {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			buf = append(buf, fmt.Sprintf("#%03o", c)...)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, '\n')
+}
+
+func (s *SyslogServer) maxMessage() int {
+	if s.MaxMessage <= 0 {
+		return DefaultMaxMessage
+	}
+	return s.MaxMessage
+}
+
+// syslogHost returns the lower case HOSTNAME field of a message or an empty
+// string if there is none.
+func syslogHost(msg []byte) string {
+	if len(msg) == 0 || msg[0] != '<' {
+		return ""
+	}
+	end := bytes.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return ""
+	}
+	rest := string(msg[end+1:])
+
+	// RFC 5424: VERSION SP TIMESTAMP SP HOSTNAME SP ...
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		fields := strings.SplitN(rest, " ", 4)
+		if len(fields) < 4 || fields[2] == "-" {
+			return ""
+		}
+		return strings.ToLower(fields[2])
+	}
+
+	// RFC 3164: TIMESTAMP ("Mmm dd hh:mm:ss") SP HOSTNAME SP TAG ...
+	if len(rest) < 16 || rest[15] != ' ' || rest[3] != ' ' || rest[9] != ':' {
+		return ""
+	}
+	fields := strings.SplitN(rest[16:], " ", 2)
+	if len(fields) < 2 || strings.ContainsAny(fields[0], ":[") {
+		// The token after the timestamp is a tag, not a host name.
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	// IPv6 addresses are no valid keys.
+	return strings.NewReplacer(":", "-", "%", "_").Replace(host)
+}
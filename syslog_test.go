@@ -0,0 +1,185 @@
+package rotwriter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogHost(t *testing.T) {
+	tests := []struct{ msg, host string }{
+		{"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - msg", "mymachine.example.com"},
+		{"<34>Oct 11 22:14:15 Mymachine su: 'su root' failed", "mymachine"},
+		{"<34>Oct  1 22:14:15 su: 'su root' failed", ""},
+		{"<13>Feb  5 17:32:18 10.0.0.99 myapp[123]: hi", "10.0.0.99"},
+		{"<13>1 - - - - - -", ""},
+		{"no priority", ""},
+	}
+	for _, test := range tests {
+		if host := syslogHost([]byte(test.msg)); host != test.host {
+			t.Errorf("syslogHost(%q) = %q, want %q", test.msg, host, test.host)
+		}
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	dir := t.TempDir()
+	s := &SyslogServer{Open: NewManager(dir, ".log", 0).Writer}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeTCP(l)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go s.ServeUDP(pc)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write([]byte("27 <34>1 - hosta app - - - one27 <34>1 - hosta app - - - a\nb<34>1 - hosta app - - - two\n"))
+	c.Close()
+
+	u, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	u.Write([]byte("<34>Oct 11 22:14:15 hostb su: x"))
+	u.Write([]byte("<34>Oct 11 22:14:15 su: noname"))
+
+	want := map[string]string{
+		"hosta.log":     "<34>1 - hosta app - - - one\n<34>1 - hosta app - - - a#012b\n<34>1 - hosta app - - - two\n",
+		"hostb.log":     "<34>Oct 11 22:14:15 hostb su: x\n",
+		"127.0.0.1.log": "<34>Oct 11 22:14:15 su: noname\n",
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for name, content := range want {
+		for {
+			data, _ := os.ReadFile(filepath.Join(dir, name))
+			if string(data) == content {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: got %q, want %q", name, data, content)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestSyslogErrorLog(t *testing.T) {
+	var buf bytes.Buffer
+	s := &SyslogServer{
+		Open: func(host string) (io.Writer, error) {
+			return nil, ErrInvalidKey
+		},
+		ErrorLog: log.New(&buf, "", 0),
+	}
+	s.handle([]byte("<34>Oct 11 22:14:15 hostb su: x"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 514})
+	if got := buf.String(); !strings.Contains(got, "hostb") || !strings.Contains(got, ErrInvalidKey.Error()) {
+		t.Errorf("got log %q", got)
+	}
+}
+
+func TestSyslogReadFrame(t *testing.T) {
+	s := &SyslogServer{MaxMessage: 100}
+	tests := []struct {
+		input string
+		msg   string
+		err   error
+	}{
+		{"5 hello", "hello", nil},
+		{"hello\nworld", "hello\n", nil},
+		{"100 " + strings.Repeat("x", 100), strings.Repeat("x", 100), nil},
+		{"101 " + strings.Repeat("x", 101), "", errFrameTooLarge},
+		{"99999999999999999999 x", "", errFrameTooLarge},
+		{"1x2 x", "", errBadFrame},
+		{strings.Repeat("x", 101) + "\n", "", errFrameTooLarge},
+	}
+	for _, test := range tests {
+		msg, err := s.readFrame(bufio.NewReader(strings.NewReader(test.input)))
+		if string(msg) != test.msg || !errors.Is(err, test.err) {
+			t.Errorf("readFrame(%.20q) = %q, %v, want %q, %v", test.input, msg, err, test.msg, test.err)
+		}
+	}
+
+	// A count without a terminating space is rejected after a few bytes
+	// instead of being buffered.
+	s = &SyslogServer{MaxMessage: 1 << 30}
+	r := &countingReader{r: strings.NewReader("1" + strings.Repeat("0", 10*1024*1024))}
+	if _, err := s.readFrame(bufio.NewReaderSize(r, 16)); !errors.Is(err, errBadFrame) {
+		t.Errorf("got %v, want errBadFrame", err)
+	}
+	if r.n > 64 {
+		t.Errorf("read %d bytes of an unterminated count", r.n)
+	}
+}
+
+func TestSyslogIdleTimeout(t *testing.T) {
+	s := &SyslogServer{
+		Open:        NewManager(t.TempDir(), ".log", 0).Writer,
+		IdleTimeout: 50 * time.Millisecond,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeTCP(l)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("1"))
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v, want the connection to be closed", err)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestSyslogAllowHost(t *testing.T) {
+	var hosts []string
+	s := &SyslogServer{
+		Open: func(host string) (io.Writer, error) {
+			hosts = append(hosts, host)
+			return io.Discard, nil
+		},
+		AllowHost: func(host string) bool { return host == "hosta" },
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 514}
+	s.handle([]byte("<34>Oct 11 22:14:15 hosta su: x"), addr)
+	s.handle([]byte("<34>Oct 11 22:14:15 spoofed su: x"), addr)
+	if want := []string{"hosta", "127.0.0.1"}; strings.Join(hosts, ",") != strings.Join(want, ",") {
+		t.Errorf("got hosts %q, want %q", hosts, want)
+	}
+}
@@ -0,0 +1,174 @@
+package rotwriter
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A Task is a kind of background work performed on rotated files.
+type Task int
+
+const (
+	// TaskCompress is the compression of files moved to a tier.
+	TaskCompress Task = iota + 1
+
+	// TaskMove is the copying of files to a tier on another file system.
+	TaskMove
+
+	// TaskSeal is the reading of rotated files for Merkle roots,
+	// timestamps and summaries.
+	TaskSeal
+)
+
+// IOClass is a Linux I/O scheduling class (see ioprio_set(2)).
+type IOClass int
+
+const (
+	// IOClassNone keeps the I/O priority of the process.
+	IOClassNone IOClass = iota
+	IOClassRealtime
+	IOClassBestEffort
+	IOClassIdle
+)
+
+// A Throttle limits the disk bandwidth and sets the I/O priority of a task.
+type Throttle struct {
+	// BytesPerSecond limits the number of bytes read per second. If no
+	// limit is indicated (<=0) the bandwidth is not limited.
+	BytesPerSecond int64
+
+	// IOClass and IOLevel (0 to 7, 0 being the highest priority) set the
+	// I/O priority of the task. They are ignored on systems other than
+	// Linux.
+	IOClass IOClass
+	IOLevel int
+}
+
+var (
+	throttleMutex sync.Mutex
+	throttles     = make(map[Task]taskThrottle)
+)
+
+// taskThrottle is the throttle of a task with the limiter shared by all
+// readers of the task.
+type taskThrottle struct {
+	Throttle
+	limiter *limiter // nil without bandwidth limit
+}
+
+// SetThrottle sets the throttle for a task. It applies to all rotate writers
+// and to functions like ApplyTiers and SealMerkle. The bandwidth is shared by
+// all files of the task being read at the same time.
+func SetThrottle(task Task, t Throttle) {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+
+	tt := taskThrottle{Throttle: t}
+	if t.BytesPerSecond > 0 {
+		tt.limiter = newLimiter(t.BytesPerSecond)
+	}
+	throttles[task] = tt
+}
+
+func throttleFor(task Task) taskThrottle {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+
+	return throttles[task]
+}
+
+// runTask runs f with the I/O priority set for task. The I/O priority is set
+// for the thread of a goroutine of its own, which is locked to the thread
+// meanwhile. If the priority cannot be restored the thread stays locked, so
+// that the runtime terminates it instead of running other goroutines with
+// the priority of the task.
+func runTask(task Task, f func() error) error {
+	t := throttleFor(task)
+	if t.IOClass == IOClassNone {
+		return f()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restore, err := setIOPriority(t.IOClass, t.IOLevel)
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+
+		err = f()
+		if rerr := restore(); rerr != nil {
+			if err == nil {
+				err = rerr
+			}
+			errc <- err
+			return
+		}
+		runtime.UnlockOSThread()
+		errc <- err
+	}()
+	return <-errc
+}
+
+// throttled returns a reader limiting r to the bandwidth set for task.
+func throttled(task Task, r io.Reader) io.Reader {
+	l := throttleFor(task).limiter
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r: r, l: l}
+}
+
+type throttledReader struct {
+	r io.Reader
+	l *limiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	// Read at most a tenth of a second worth of data at once to keep the
+	// rate smooth.
+	if max := tr.l.rate/10 + 1; int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := tr.r.Read(p)
+	tr.l.wait(n)
+	return n, err
+}
+
+// limiter is a token bucket holding up to a tenth of a second worth of
+// bytes. It starts empty. Readers take the bytes read from the bucket and
+// wait while it is in debt.
+type limiter struct {
+	mutex  sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: rate, last: time.Now()}
+}
+
+// wait takes n bytes from the bucket and blocks until the bucket is no
+// longer in debt.
+func (l *limiter) wait(n int) {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if max := float64(l.rate/10 + 1); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	l.mutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,80 @@
+package rotwriter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	SetThrottle(TaskMove, Throttle{BytesPerSecond: 1000000})
+	defer SetThrottle(TaskMove, Throttle{})
+
+	data := make([]byte, 300000)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, throttled(TaskMove, bytes.NewReader(data)))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("read %d bytes in %v at 1 MB/s", n, d)
+	}
+
+	if _, ok := throttled(TaskCompress, bytes.NewReader(data)).(*throttledReader); ok {
+		t.Error("unthrottled task is throttled")
+	}
+}
+
+func TestThrottledReadersShareLimit(t *testing.T) {
+	SetThrottle(TaskMove, Throttle{BytesPerSecond: 1000000})
+	defer SetThrottle(TaskMove, Throttle{})
+
+	// Each reader alone would take 300 ms, together they take 600 ms.
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := throttled(TaskMove, bytes.NewReader(make([]byte, 300000)))
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if d := time.Since(start); d < 550*time.Millisecond {
+		t.Errorf("two readers read 600000 bytes in %v at 1 MB/s", d)
+	}
+}
+
+func TestThrottledTask(t *testing.T) {
+	dir := t.TempDir()
+	seg := filepath.Join(dir, "app-"+time.Now().Add(-2*time.Hour).Format(stampFormat)+".log")
+	if err := os.WriteFile(seg, make([]byte, 300000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	SetThrottle(TaskCompress, Throttle{BytesPerSecond: 1000000, IOClass: IOClassIdle})
+	defer SetThrottle(TaskCompress, Throttle{})
+
+	start := time.Now()
+	tiers := []Tier{{Dir: filepath.Join(dir, "old"), Age: time.Hour, Compress: true}}
+	if err := ApplyTiers(filepath.Join(dir, "app.log"), tiers); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("compressed 300000 bytes in %v at 1 MB/s", d)
+	}
+
+	errTask := errors.New("task failed")
+	SetThrottle(TaskSeal, Throttle{IOClass: IOClassBestEffort, IOLevel: 7})
+	defer SetThrottle(TaskSeal, Throttle{})
+	if err := runTask(TaskSeal, func() error { return errTask }); err != errTask {
+		t.Errorf("got %v, want the error of the task", err)
+	}
+}
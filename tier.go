@@ -0,0 +1,402 @@
+package rotwriter
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrNoDigest is returned by VerifyContentName for files whose name
+	// holds no digest.
+	ErrNoDigest = errors.New("rotwriter: file name holds no digest")
+
+	// ErrDigestMismatch is returned by VerifyContentName if the content of
+	// a file does not match the digest in its name.
+	ErrDigestMismatch = errors.New("rotwriter: content does not match digest")
+)
+
+// stampFormat is the format of the timestamp in the name of rotated files.
+const stampFormat = "20060102-150405"
+
+// A Tier is a storage location rotated files are moved to once they have
+// reached a certain age.
+type Tier struct {
+	// Dir is the directory of the tier.
+	Dir string
+
+	// Age is the minimum age of the files stored in this tier.
+	Age time.Duration
+
+	// Retention is the age after which files of this tier are deleted. If
+	// no retention is indicated (<=0) files are kept.
+	Retention time.Duration
+
+	// Compress indicates that files are gzip compressed when being moved
+	// to this tier.
+	Compress bool
+}
+
+// A Segment is a rotated file of a rotate writer.
+type Segment struct {
+	// Path is the current location of the file.
+	Path string
+
+	// Time is the time the file has been rotated.
+	Time time.Time
+
+	// Size is the size of the file as stored (i.e. compressed).
+	Size int64
+
+	// Tier is the index of the tier holding the file plus one. Files in
+	// the directory of the rotate writer have a tier of 0.
+	Tier int
+
+	// Compressed indicates a gzip compressed file.
+	Compressed bool
+}
+
+// Open opens the segment for reading. Compressed segments are decompressed
+// transparently.
+func (s Segment) Open() (io.ReadCloser, error) {
+	return s.open(0)
+}
+
+// open opens the segment with the bandwidth of the file limited as set for
+// task.
+func (s Segment) open(task Task) (io.ReadCloser, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := throttled(task, file)
+	if !s.Compressed {
+		return readCloser{r, file}, nil
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{zr, file}, nil
+}
+
+// openSegment opens a rotated file by its path for reading.
+func openSegment(path string, task Task) (io.ReadCloser, error) {
+	return Segment{Path: path, Compressed: strings.HasSuffix(path, ".gz")}.open(task)
+}
+
+// sidecarPath returns the path of a file stored along with a rotated file.
+// Sidecar files keep their name when the rotated file is being compressed.
+func sidecarPath(path, ext string) string {
+	return strings.TrimSuffix(path, ".gz") + ext
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// Segments returns the rotated files of the rotate writer for filename that
+// are stored in its directory or one of the tiers, ordered by time. The time
+// of files recorded in the manifest is taken from the manifest. Files named
+// by their content that are missing in the manifest get their modification
+// time.
+func Segments(filename string, tiers []Tier) ([]Segment, error) {
+	dirs := []string{filepath.Dir(filename)}
+	for _, tier := range tiers {
+		dirs = append(dirs, tier.Dir)
+	}
+
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+
+	var segments []Segment
+	var times map[string]time.Time
+	for i, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			compressed := strings.HasSuffix(name, ".gz")
+			stamp := strings.TrimSuffix(name, ".gz")
+			if !strings.HasPrefix(stamp, prefix) || !strings.HasSuffix(stamp, ext) {
+				continue
+			}
+			stamp = stamp[len(prefix) : len(stamp)-len(ext)]
+			t, err := time.ParseInLocation(stampFormat, stamp, time.Local)
+			if err != nil && !isDigest(stamp) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if times == nil {
+				if times, err = manifestTimes(filename); err != nil {
+					return nil, err
+				}
+			}
+			if mt, ok := times[strings.TrimSuffix(name, ".gz")]; ok {
+				t = mt
+			} else if isDigest(stamp) {
+				t = info.ModTime()
+			}
+			segments = append(segments, Segment{
+				Path:       filepath.Join(dir, name),
+				Time:       t,
+				Size:       info.Size(),
+				Tier:       i,
+				Compressed: compressed,
+			})
+		}
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Time.Before(segments[j].Time)
+	})
+	return segments, nil
+}
+
+// manifestTimes returns the latest rotation time of the files recorded in the
+// manifest of the rotate writer for filename.
+func manifestTimes(filename string) (map[string]time.Time, error) {
+	entries, err := ReadManifest(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		if entry.Time.After(times[entry.Name]) {
+			times[entry.Name] = entry.Time
+		}
+	}
+	return times, nil
+}
+
+// isDigest reports whether s is a hex encoded SHA-256 digest as used by
+// WithContentNames.
+func isDigest(s string) bool {
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// VerifyContentName checks that the content of a rotated file named by
+// WithContentNames matches the digest in its name.
+func VerifyContentName(path string) error {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 || !isDigest(name[i+1:]) {
+		return ErrNoDigest
+	}
+
+	digest, err := contentDigest(path, 0)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest) != name[i+1:] {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// ApplyTiers moves the rotated files of the rotate writer for filename to the
+// tier matching their age and deletes files that exceeded the retention of
+// their tier. The tiers must be ordered by increasing age. Files are never
+// moved back to a lower tier. ApplyTiers is typically called periodically,
+// and may also be registered as the last function of WithPostRotate.
+func ApplyTiers(filename string, tiers []Tier) error {
+	segments, err := Segments(filename, tiers)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, seg := range segments {
+		target, remove := tierAction(now.Sub(seg.Time), seg.Tier, tiers)
+		if remove {
+			if err := removeSegment(seg); err != nil {
+				return err
+			}
+		} else if target != seg.Tier {
+			if err := moveSegment(seg, tiers[target-1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tierAction returns the tier a file of the specified age currently stored
+// in tier current belongs to, and whether it has to be deleted instead.
+func tierAction(age time.Duration, current int, tiers []Tier) (target int, remove bool) {
+	target = current
+	for i, tier := range tiers {
+		if age >= tier.Age && i+1 > target {
+			target = i + 1
+		}
+	}
+	if target == 0 {
+		return 0, false
+	}
+
+	tier := tiers[target-1]
+	return target, tier.Retention > 0 && age >= tier.Retention
+}
+
+// moveSegment moves a segment and its sidecar files to the directory of a
+// tier, compressing the segment if requested by the tier.
+func moveSegment(seg Segment, tier Tier) error {
+	if err := os.MkdirAll(tier.Dir, 0777); err != nil {
+		return err
+	}
+
+	sidecars, err := sidecarFiles(seg)
+	if err != nil {
+		return err
+	}
+	for _, src := range sidecars {
+		if err := moveFile(src, filepath.Join(tier.Dir, filepath.Base(src)), false); err != nil {
+			return err
+		}
+	}
+
+	return moveFile(seg.Path, filepath.Join(tier.Dir, filepath.Base(seg.Path)), tier.Compress && !seg.Compressed)
+}
+
+// removeSegment deletes a segment and its sidecar files.
+func removeSegment(seg Segment) error {
+	sidecars, err := sidecarFiles(seg)
+	if err != nil {
+		return err
+	}
+	for _, name := range sidecars {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return os.Remove(seg.Path)
+}
+
+// sidecarFiles returns the paths of the sidecar files of a segment.
+func sidecarFiles(seg Segment) ([]string, error) {
+	matches, err := filepath.Glob(sidecarPath(seg.Path, ".*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sidecars []string
+	for _, name := range matches {
+		if name != seg.Path && !strings.HasSuffix(name, ".gz") && !strings.HasSuffix(name, ".tmp") {
+			sidecars = append(sidecars, name)
+		}
+	}
+	return sidecars, nil
+}
+
+// moveFile moves a file, compressing it if requested.
+func moveFile(src, dst string, compress bool) error {
+	if compress {
+		dst += ".gz"
+	} else {
+		err := os.Rename(src, dst)
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+
+	// Copy to a temporary file in the target directory (either for
+	// compression or because the tier is on another file system) and
+	// only remove the source once the copy is complete.
+	task := TaskMove
+	if compress {
+		task = TaskCompress
+	}
+	err := runTask(task, func() error {
+		return copyFile(src, dst, compress, task)
+	})
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string, compress bool, task Task) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	err = writeCopy(out, throttled(task, in), compress)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func writeCopy(w io.Writer, r io.Reader, compress bool) error {
+	if !compress {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	return zw.Close()
+}
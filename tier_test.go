@@ -0,0 +1,103 @@
+package rotwriter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyTiers(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	ages := []time.Duration{100 * time.Hour, 30 * time.Hour, 2 * time.Hour, time.Minute}
+	for _, age := range ages {
+		name := filepath.Join(dir, "app-"+now.Add(-age).Format(stampFormat)+".log")
+		if err := os.WriteFile(name, []byte("data "+age.String()+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := SealMerkle(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "app-foo.log"), nil, 0666)
+
+	tiers := []Tier{
+		{Dir: filepath.Join(dir, "hdd"), Age: time.Hour},
+		{Dir: filepath.Join(dir, "archive"), Age: 24 * time.Hour, Retention: 72 * time.Hour, Compress: true},
+	}
+	if err := ApplyTiers(filename, tiers); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := Segments(filename, tiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	want := []struct {
+		tier       int
+		compressed bool
+	}{{2, true}, {1, false}, {0, false}}
+	for i, seg := range segments {
+		if seg.Tier != want[i].tier || seg.Compressed != want[i].compressed {
+			t.Errorf("segment %d: got tier %d (compressed %v), want %d (%v)", i, seg.Tier, seg.Compressed, want[i].tier, want[i].compressed)
+		}
+
+		r, err := seg.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "data "+ages[i+1].String()+"\n" {
+			t.Errorf("segment %d: got %q", i, data)
+		}
+
+		// Sidecar files move along with their segment.
+		if _, _, err := MerkleRoot(seg.Path); err != nil {
+			t.Errorf("segment %d: %v", i, err)
+		}
+	}
+
+	// The expired file has been deleted together with its sidecar, so
+	// every directory holds one sidecar.
+	for _, d := range []string{dir, tiers[0].Dir, tiers[1].Dir} {
+		if matches, _ := filepath.Glob(filepath.Join(d, "*.merkle")); len(matches) != 1 {
+			t.Errorf("%s: got sidecars %v", d, matches)
+		}
+	}
+}
+
+func TestTierAction(t *testing.T) {
+	tiers := []Tier{
+		{Age: time.Hour},
+		{Age: 24 * time.Hour, Retention: 72 * time.Hour},
+	}
+	tests := []struct {
+		age     time.Duration
+		current int
+		target  int
+		remove  bool
+	}{
+		{time.Minute, 0, 0, false},
+		{2 * time.Hour, 0, 1, false},
+		{30 * time.Hour, 0, 2, false},
+		{30 * time.Hour, 1, 2, false},
+		{2 * time.Hour, 2, 2, false},
+		{100 * time.Hour, 0, 2, true},
+	}
+	for _, test := range tests {
+		target, remove := tierAction(test.age, test.current, tiers)
+		if target != test.target || remove != test.remove {
+			t.Errorf("tierAction(%v, %d) = %d, %v, want %d, %v", test.age, test.current, target, remove, test.target, test.remove)
+		}
+	}
+}
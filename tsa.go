@@ -0,0 +1,373 @@
+package rotwriter
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// DefaultTSATimeout is the timeout of the requests of a TSA if no other client
+// is being specified (30 seconds)
+const DefaultTSATimeout = 30 * time.Second
+
+var tsaClient = &http.Client{Timeout: DefaultTSATimeout}
+
+// ErrTimestampMismatch is returned by VerifyTimestamp if the timestamp token
+// does not match the content of the file.
+var ErrTimestampMismatch = errors.New("rotwriter: timestamp does not match file")
+
+// TSA requests RFC 3161 timestamp tokens from a time-stamping authority.
+type TSA struct {
+	// URL is the address of the time-stamping authority.
+	URL string
+
+	// Client is used for the requests. If no client is indicated a client
+	// with a timeout of DefaultTSATimeout is used.
+	Client *http.Client
+}
+
+// Timestamp requests a timestamp token over the SHA-256 digest of the content
+// of a rotated file and stores the reply of the authority next to the file
+// (with the additional extension .tsr). The reply is checked as by
+// VerifyTimestamp without validating the certificate chain. It can be used
+// with WithPostRotate:
+//
+//	tsa := &rotwriter.TSA{URL: "http://tsa.example.com"}
+//	rotwriter.WithPostRotate(tsa.Timestamp)
+func (t *TSA) Timestamp(name string) error {
+	var digest []byte
+	err := runTask(TaskSeal, func() (err error) {
+		digest, err = contentDigest(name, TaskSeal)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, digest},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := t.Client
+	if client == nil {
+		client = tsaClient
+	}
+	resp, err := client.Post(t.URL, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rotwriter: time-stamping authority returned %s", resp.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return err
+	}
+
+	info, err := verifyReply(reply, digest, nil)
+	if err != nil {
+		return err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return errors.New("rotwriter: timestamp nonce mismatch")
+	}
+
+	return os.WriteFile(sidecarPath(name, ".tsr"), reply, 0666)
+}
+
+// VerifyTimestamp checks the timestamp token stored for a rotated file by
+// TSA.Timestamp against the content of the file and returns the time of the
+// timestamp. The signature of the token is checked with the certificate
+// included in the token. If roots is not nil the certificate must also
+// chain up to one of the roots.
+func VerifyTimestamp(name string, roots *x509.CertPool) (time.Time, error) {
+	reply, err := os.ReadFile(sidecarPath(name, ".tsr"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	digest, err := contentDigest(name, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := verifyReply(reply, digest, roots)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.GenTime, nil
+}
+
+// contentDigest returns the SHA-256 digest of the (uncompressed) content of
+// a rotated file, reading it as set for task.
+func contentDigest(name string, task Task) ([]byte, error) {
+	file, err := openSegment(name, task)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status struct {
+		Status       int
+		StatusString []asn1.RawValue `asn1:"optional"`
+		FailInfo     asn1.BitString  `asn1:"optional"`
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+	Certificates rawContent   `asn1:"optional,tag:0"`
+	CRLs         rawContent   `asn1:"optional,tag:1"`
+	SignerInfos  []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+// rawContent captures a constructed element of any content.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	} `asn1:"optional"`
+	Ordering bool          `asn1:"optional"`
+	Nonce    *big.Int      `asn1:"optional"`
+	TSA      asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+// verifyReply parses a TimeStampResp, checks that it grants a token over
+// digest and verifies the signature of the token.
+func verifyReply(reply, digest []byte, roots *x509.CertPool) (*tstInfo, error) {
+	var resp timeStampResp
+	if _, err := asn1.Unmarshal(reply, &resp); err != nil {
+		return nil, err
+	}
+	// 0 is granted, 1 granted with modifications.
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("rotwriter: timestamp request rejected with status %d", resp.Status.Status)
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(resp.TimeStampToken.FullBytes, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("rotwriter: timestamp token is no signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("rotwriter: timestamp token holds no TSTInfo")
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, err
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, ErrTimestampMismatch
+	}
+
+	if err := verifySignedData(&sd, info.GenTime, roots); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// verifySignedData checks the signature of the first signer of sd with the
+// matching certificate included in sd.
+func verifySignedData(sd *signedData, now time.Time, roots *x509.CertPool) error {
+	if len(sd.SignerInfos) == 0 {
+		return errors.New("rotwriter: timestamp token is not signed")
+	}
+	si := sd.SignerInfos[0]
+
+	var certData asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.Certificates.Raw, &certData); err != nil {
+		return errors.New("rotwriter: timestamp token carries no certificates")
+	}
+	certs, err := x509.ParseCertificates(certData.Bytes)
+	if err != nil {
+		return err
+	}
+	var cert *x509.Certificate
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(si.SID.FullBytes, &ias); err == nil {
+		for _, c := range certs {
+			if c.SerialNumber.Cmp(ias.Serial) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+				cert = c
+			}
+		}
+	} else if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+				cert = c
+			}
+		}
+	}
+	if cert == nil {
+		return errors.New("rotwriter: timestamp token carries no signer certificate")
+	}
+
+	var hash crypto.Hash
+	switch alg := si.DigestAlgorithm.Algorithm; {
+	case alg.Equal(oidSHA256):
+		hash = crypto.SHA256
+	case alg.Equal(oidSHA384):
+		hash = crypto.SHA384
+	case alg.Equal(oidSHA512):
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("rotwriter: unsupported digest algorithm %v", alg)
+	}
+
+	// The signed attributes must hold the digest of the content.
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.Raw, &attrs, "set,tag:0"); err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(sd.EncapContentInfo.EContent)
+	found := false
+	for _, attr := range attrs {
+		if attr.Type.Equal(oidMessageDigest) && len(attr.Values) == 1 {
+			var md []byte
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &md); err != nil {
+				return err
+			}
+			found = bytes.Equal(md, h.Sum(nil))
+		}
+	}
+	if !found {
+		return errors.New("rotwriter: timestamp token digest mismatch")
+	}
+
+	// The signature is calculated over the DER encoding of the signed
+	// attributes as a SET, not with the implicit tag of the field.
+	signed := append([]byte{0x31}, si.SignedAttrs.Raw[1:]...)
+	if err := cert.CheckSignature(signatureAlgorithm(cert, hash), signed, si.Signature); err != nil {
+		return err
+	}
+
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		return err
+	}
+	return nil
+}
+
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) x509.SignatureAlgorithm {
+	algs := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA: {
+			crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA,
+			crypto.SHA512: x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		},
+	}
+	return algs[cert.PublicKeyAlgorithm][hash]
+}
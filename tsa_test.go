@@ -0,0 +1,279 @@
+package rotwriter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// standInTSA is a time-stamping authority for tests. It signs tokens with
+// ECDSA and can be told to send broken replies.
+type standInTSA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+
+	badSignature bool
+	badNonce     bool
+	badImprint   bool
+}
+
+type testSignerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	Encap            struct {
+		Type    asn1.ObjectIdentifier
+		Content []byte `asn1:"explicit,tag:0"`
+	}
+	Certificates asn1.RawValue
+	SignerInfos  []testSignerInfo `asn1:"set"`
+}
+
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type testTimeStampResp struct {
+	Status struct{ Status int }
+	Token  asn1.RawValue
+}
+
+type testContentInfo struct {
+	Type    asn1.ObjectIdentifier
+	Content asn1.RawValue
+}
+
+func newStandInTSA(t *testing.T) *standInTSA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(7),
+		Subject:               pkix.Name{CommonName: "stand-in TSA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &standInTSA{key: key, cert: cert}
+}
+
+func (tsa *standInTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tsa.badNonce {
+		req.Nonce = new(big.Int).Add(req.Nonce, big.NewInt(1))
+	}
+	if tsa.badImprint {
+		req.MessageImprint.HashedMessage = make([]byte, sha256.Size)
+	}
+
+	tst, _ := asn1.Marshal(testTSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(1),
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	digest := sha256.Sum256(tst)
+	digestValue, _ := asn1.Marshal(digest[:])
+	attrs, _ := asn1.MarshalWithParams([]attribute{{oidMessageDigest, []asn1.RawValue{{FullBytes: digestValue}}}}, "set")
+	h := sha256.Sum256(attrs)
+	sig, _ := ecdsa.SignASN1(rand.Reader, tsa.key, h[:])
+	if tsa.badSignature {
+		sig[len(sig)-1] ^= 1
+	}
+
+	sd := testSignedData{Version: 3, DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}}}
+	sd.Encap.Type = oidTSTInfo
+	sd.Encap.Content = tst
+	certs, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw})
+	sd.Certificates = asn1.RawValue{FullBytes: certs}
+	sd.SignerInfos = []testSignerInfo{{
+		Version:            1,
+		SID:                issuerAndSerial{asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, tsa.cert.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, attrs[1:]...)},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          sig,
+	}}
+	sdDER, _ := asn1.Marshal(sd)
+	ci, _ := asn1.Marshal(testContentInfo{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER}})
+	resp, _ := asn1.Marshal(testTimeStampResp{Token: asn1.RawValue{FullBytes: ci}})
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+func TestTimestamp(t *testing.T) {
+	tsa := newStandInTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+
+	name := filepath.Join(t.TempDir(), "app-1.log")
+	if err := os.WriteFile(name, []byte("hello\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+	if err := (&TSA{URL: srv.URL}).Timestamp(name); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.cert)
+	ts, err := VerifyTimestamp(name, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Before(before) || ts.After(time.Now()) {
+		t.Errorf("got time %v", ts)
+	}
+
+	// A certificate not chaining up to the roots is rejected.
+	other := newStandInTSA(t)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.cert)
+	if _, err := VerifyTimestamp(name, otherRoots); err == nil {
+		t.Error("token verified with foreign roots")
+	}
+
+	// A tampered signature in the stored reply is rejected.
+	tsr := sidecarPath(name, ".tsr")
+	reply, err := os.ReadFile(tsr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply[len(reply)-1] ^= 1
+	if err := os.WriteFile(tsr, reply, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyTimestamp(name, nil); err == nil {
+		t.Error("tampered token verified")
+	}
+	reply[len(reply)-1] ^= 1
+	os.WriteFile(tsr, reply, 0666)
+
+	// Changed content no longer matches the token.
+	if err := os.WriteFile(name, []byte("hellx\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyTimestamp(name, nil); err != ErrTimestampMismatch {
+		t.Errorf("got %v, want ErrTimestampMismatch", err)
+	}
+}
+
+func TestTimestampBadReply(t *testing.T) {
+	tests := map[string]func(tsa *standInTSA){
+		"signature": func(tsa *standInTSA) { tsa.badSignature = true },
+		"nonce":     func(tsa *standInTSA) { tsa.badNonce = true },
+		"imprint":   func(tsa *standInTSA) { tsa.badImprint = true },
+	}
+	for what, broken := range tests {
+		tsa := newStandInTSA(t)
+		broken(tsa)
+		srv := httptest.NewServer(tsa)
+
+		name := filepath.Join(t.TempDir(), "app-1.log")
+		os.WriteFile(name, []byte("hello\n"), 0666)
+		if err := (&TSA{URL: srv.URL}).Timestamp(name); err == nil {
+			t.Errorf("reply with bad %s accepted", what)
+		}
+		if _, err := os.Stat(sidecarPath(name, ".tsr")); !os.IsNotExist(err) {
+			t.Errorf("reply with bad %s stored", what)
+		}
+		srv.Close()
+	}
+}
+
+// TestVerifyTimestampOpenSSL checks a reply created by
+//
+//	openssl ts -query -data timestamp.log -sha256 -cert -out q.tsq
+//	openssl ts -reply -config ts.cnf -queryfile q.tsq -out timestamp.log.tsr
+//
+// with an RSA signer certificate (tsa.pem) valid for 100 years.
+func TestVerifyTimestampOpenSSL(t *testing.T) {
+	data, err := os.ReadFile("testdata/tsa.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	if _, err := VerifyTimestamp("testdata/timestamp.log", roots); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "timestamp.log")
+	reply, _ := os.ReadFile("testdata/timestamp.log.tsr")
+	os.WriteFile(name+".tsr", reply, 0666)
+	os.WriteFile(name, []byte("first line\nsecond line\n\n"), 0666)
+	if _, err := VerifyTimestamp(name, roots); err != ErrTimestampMismatch {
+		t.Errorf("got %v, want ErrTimestampMismatch", err)
+	}
+}
+
+func TestTSAClientTimeout(t *testing.T) {
+	stall := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer srv.Close()
+	defer close(stall)
+
+	if tsaClient.Timeout <= 0 {
+		t.Fatal("default client has no timeout")
+	}
+	name := filepath.Join(t.TempDir(), "app-1.log")
+	os.WriteFile(name, []byte("hello\n"), 0666)
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if err := (&TSA{URL: srv.URL, Client: client}).Timestamp(name); err == nil {
+		t.Error("stalled authority did not fail")
+	}
+}